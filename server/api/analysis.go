@@ -0,0 +1,101 @@
+// Package api holds the types of the public API, shared by the server and
+// the CLIs talking to it so producers and consumers can't drift apart.
+package api
+
+import (
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/git"
+)
+
+// Version is the version of the AnalysisResult JSON contract. Bump it on
+// changes clients have to know about, cached results of older versions are
+// recomputed.
+const Version = 1
+
+// AnalyzeRequest is the body of POST /api/analyze
+type AnalyzeRequest struct {
+	Username string `json:"username" validate:"required,min=1,max=255"`
+	Repo     string `json:"repo" validate:"required,min=1,max=255"`
+	Releases bool   `json:"releases"` // fetch tags and include the release timeline
+}
+
+// AnalysisResult is the analysis of a repository as it is sent to clients
+// and stored in the cache. The GitHub sections are nil when GitHub could not
+// be reached, Releases is only set when the release timeline was requested.
+type AnalysisResult struct {
+	Version           int                    `json:"version"`
+	TotalAdded        int                    `json:"totalAdded"`
+	TotalRemoved      int                    `json:"totalRemoved"`
+	TotalContributors int                    `json:"totalContributors"`
+	TotalCommits      int                    `json:"totalCommits"`
+	Commits           []database.CommitStats `json:"commits"`
+	GitHub            *GitHubRepo            `json:"github"`
+	PullRequests      *GitHubSearchResult    `json:"pullRequests"`
+	Issues            *IssueStats            `json:"issues"`
+	Releases          *git.ReleaseTimeline   `json:"releases,omitempty"`
+}
+
+// ContributorProfiles are the profiles of the authors with the most commits
+// of an analysis, built from details of the commits that are not sent. They
+// are cached apart from the analysis.
+type ContributorProfiles struct {
+	Total        int                           `json:"total"`
+	Contributors []database.ContributorProfile `json:"contributors"`
+}
+
+// Sections lists the top level keys of the result that are not null
+func (r *AnalysisResult) Sections() []string {
+	sections := []string{"version", "totalAdded", "totalRemoved", "totalContributors", "totalCommits"}
+	if r.Commits != nil {
+		sections = append(sections, "commits")
+	}
+	if r.GitHub != nil {
+		sections = append(sections, "github")
+	}
+	if r.PullRequests != nil {
+		sections = append(sections, "pullRequests")
+	}
+	if r.Issues != nil {
+		sections = append(sections, "issues")
+	}
+	if r.Releases != nil {
+		sections = append(sections, "releases")
+	}
+	return sections
+}
+
+// RepoData is the repos row saved for the result
+func (r *AnalysisResult) RepoData(username, repoName string, histogram []int) database.RepoData {
+	data := database.RepoData{
+		Username:       username,
+		RepoName:       repoName,
+		TotalAdditions: r.TotalAdded,
+		TotalLines:     r.TotalAdded - r.TotalRemoved,
+		TotalRemovals:  r.TotalRemoved,
+		LinesHistogram: histogram,
+		TotalCommits:   r.TotalCommits,
+	}
+	if r.GitHub != nil {
+		data.TotalStars = r.GitHub.StargazersCount
+		data.Language = r.GitHub.Language
+		data.Size = r.GitHub.Size
+	}
+	return data
+}
+
+// AnalysisRun is the history snapshot saved for the result
+func (r *AnalysisResult) AnalysisRun(headSHA string, histogram []int) database.AnalysisRun {
+	run := database.AnalysisRun{
+		HeadSHA:           headSHA,
+		TotalAdditions:    r.TotalAdded,
+		TotalRemovals:     r.TotalRemoved,
+		TotalLines:        r.TotalAdded - r.TotalRemoved,
+		TotalCommits:      r.TotalCommits,
+		TotalContributors: r.TotalContributors,
+		LinesHistogram:    histogram,
+	}
+	if r.GitHub != nil {
+		run.TotalStars = r.GitHub.StargazersCount
+	}
+	return run
+}
@@ -0,0 +1,94 @@
+package api
+
+type GitHubRepo struct {
+	StargazersCount int    `json:"stargazers_count"`
+	Language        string `json:"language"`
+	Size            int    `json:"size"`
+	PushedAt        string `json:"pushed_at"`
+	Archived        bool   `json:"archived"`
+}
+
+// GitHubRepoSearchResult is a page of the GitHub repository search
+type GitHubRepoSearchResult struct {
+	Items []GitHubRepoSearchItem `json:"items"`
+}
+
+type GitHubRepoSearchItem struct {
+	Name            string     `json:"name"`
+	Owner           GitHubUser `json:"owner"`
+	Description     string     `json:"description"`
+	Language        string     `json:"language"`
+	StargazersCount int        `json:"stargazers_count"`
+}
+
+type GitHubPullRequest struct {
+	ID          int64                  `json:"id"`
+	Number      int                    `json:"number"`
+	Title       string                 `json:"title"`
+	Body        string                 `json:"body"`
+	User        GitHubUser             `json:"user"`
+	CreatedAt   string                 `json:"created_at"`
+	State       string                 `json:"state"`
+	HTMLURL     string                 `json:"html_url"`
+	Comments    int                    `json:"comments"`
+	PullRequest *GitHubPullRequestInfo `json:"pull_request,omitempty"`
+	Reactions   GitHubReactions        `json:"reactions"`
+}
+
+type GitHubPullRequestInfo struct {
+	MergedAt *string `json:"merged_at"`
+}
+
+type GitHubReactions struct {
+	TotalCount int `json:"total_count"`
+	PlusOne    int `json:"+1"`
+	MinusOne   int `json:"-1"`
+	Laugh      int `json:"laugh"`
+	Hooray     int `json:"hooray"`
+	Confused   int `json:"confused"`
+	Heart      int `json:"heart"`
+	Rocket     int `json:"rocket"`
+	Eyes       int `json:"eyes"`
+}
+
+type GitHubUser struct {
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+}
+
+type GitHubSearchResult struct {
+	TotalCount int                 `json:"total_count"`
+	Items      []GitHubPullRequest `json:"items"`
+}
+
+type IssueStats struct {
+	TotalOpened            int           `json:"totalOpened"`
+	TotalClosed            int           `json:"totalClosed"`
+	OpenIssues             int           `json:"openIssues"`
+	MedianTimeToCloseHours float64       `json:"medianTimeToCloseHours"`
+	Monthly                []IssueMonth  `json:"monthly"`
+	Labels                 []IssueLabel  `json:"labels"`
+	TopReporters           []IssueAuthor `json:"topReporters"`
+	Truncated              bool          `json:"truncated"` // true when only the most recent issues were fetched
+}
+
+// IssueMonth holds the issue activity of one calendar month, Backlog is the
+// number of issues still open at the end of the month, nil when it can't be
+// told
+type IssueMonth struct {
+	Month   string `json:"month"`
+	Opened  int    `json:"opened"`
+	Closed  int    `json:"closed"`
+	Backlog *int   `json:"backlog,omitempty"`
+}
+
+type IssueLabel struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type IssueAuthor struct {
+	User   GitHubUser `json:"user"`
+	Issues int        `json:"issues"`
+}
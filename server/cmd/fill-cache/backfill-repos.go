@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,25 +12,16 @@ import (
 	"sync"
 	"time"
 
+	"github.com/immatheus/gitback/api"
 	database "github.com/immatheus/gitback/databases"
 	"github.com/joho/godotenv"
 )
 
-type AnalyzeRequest struct {
-	Username string `json:"username"`
-	Repo     string `json:"repo"`
-}
-
-type AnalyzeResponse struct {
-	Message           string `json:"message"`
-	TotalAdded        int    `json:"totalAdded"`
-	TotalRemoved      int    `json:"totalRemoved"`
-	TotalContributors int    `json:"totalContributors"`
-}
-
 type RepoInfo struct {
-	Username string
-	Repo     string
+	Username     string
+	Repo         string
+	LastCachedAt *time.Time
+	CacheTTL     time.Duration
 }
 
 type RequestResult struct {
@@ -40,27 +32,47 @@ type RequestResult struct {
 }
 
 func fetchAllReposFromDB() ([]RepoInfo, error) {
-	if err := database.Init(os.Getenv("DATABASE_URL")); err != nil {
+	if err := database.Open(os.Getenv("DATABASE_URL")); err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer database.Close()
 
-	repos, err := database.GetTopRepos()
+	repos, _, err := database.GetTopRepos(database.TopReposQuery{Sort: database.SortLines})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch repos from database: %w", err)
 	}
 
 	var repoInfos []RepoInfo
 	for _, repo := range repos {
-		repoInfos = append(repoInfos, RepoInfo{
-			Username: repo.Username,
-			Repo:     repo.RepoName,
-		})
+		info := RepoInfo{
+			Username:     repo.Username,
+			Repo:         repo.RepoName,
+			LastCachedAt: repo.LastCachedAt,
+		}
+		if repo.CacheTTLSeconds != nil {
+			info.CacheTTL = time.Duration(*repo.CacheTTLSeconds) * time.Second
+		}
+		repoInfos = append(repoInfos, info)
 	}
 
 	return repoInfos, nil
 }
 
+// skipFreshRepos drops repos whose cached analysis is still within the TTL
+// picked from their activity, requesting them again would only count a view
+func skipFreshRepos(repos []RepoInfo) []RepoInfo {
+	var stale []RepoInfo
+	for _, repo := range repos {
+		if repo.LastCachedAt != nil && time.Since(*repo.LastCachedAt) < repo.CacheTTL {
+			continue
+		}
+		stale = append(stale, repo)
+	}
+
+	log.Printf("Skipping %d repositories whose cache is still fresh", len(repos)-len(stale))
+	return stale
+}
+
 func mergeAndDeduplicateRepos(dbRepos []RepoInfo, hardcodedRepos []struct {
 	Username string
 	Repo     string
@@ -107,6 +119,9 @@ func mergeAndDeduplicateRepos(dbRepos []RepoInfo, hardcodedRepos []struct {
 }
 
 func main() {
+	force := flag.Bool("force", false, "re-analyze repos whose cached analysis is still fresh")
+	flag.Parse()
+
 	// Load environment variables
 	godotenv.Load()
 
@@ -125,6 +140,9 @@ func main() {
 		dbRepos = []RepoInfo{} // Use empty slice if DB fetch fails
 	} else {
 		log.Printf("Found %d repositories in database", len(dbRepos))
+		if !*force {
+			dbRepos = skipFreshRepos(dbRepos)
+		}
 	}
 
 	// List of popular GitHub repositories (hardcoded)
@@ -230,7 +248,7 @@ func main() {
 				fmt.Printf("[Worker %d] [%d/%d] Analyzing %s/%s...\n",
 					workerID+1, work.index+1, len(repos), work.repo.Username, work.repo.Repo)
 
-				reqBody := AnalyzeRequest{
+				reqBody := api.AnalyzeRequest{
 					Username: work.repo.Username,
 					Repo:     work.repo.Repo,
 				}
@@ -275,7 +293,7 @@ func main() {
 				}
 
 				if resp.StatusCode == http.StatusOK {
-					var result AnalyzeResponse
+					var result api.AnalysisResult
 					successCount++
 					results = append(results, RequestResult{
 						Repo:     repoName,
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	database "github.com/immatheus/gitback/databases"
+	"github.com/joho/godotenv"
+)
+
+const usage = "Usage: go run ./cmd/migrate <up|down [steps]|status>"
+
+func main() {
+	godotenv.Load()
+
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	if err := database.Open(os.Getenv("DATABASE_URL")); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	switch os.Args[1] {
+	case "up":
+		if err := database.Migrate(); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		printStatus()
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of steps: %s", os.Args[2])
+			}
+			steps = n
+		}
+		if err := database.Rollback(steps); err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		printStatus()
+
+	case "status":
+		printStatus()
+
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func printStatus() {
+	status, err := database.GetMigrationStatus()
+	if err != nil {
+		log.Fatalf("Failed to get migration status: %v", err)
+	}
+
+	fmt.Printf("Current version: %d\n", status.Current)
+	fmt.Printf("Latest version:  %d\n", status.Latest)
+	if len(status.Pending) == 0 {
+		fmt.Printf("No pending migrations\n")
+		return
+	}
+
+	fmt.Printf("Pending migrations:\n")
+	for _, migration := range status.Pending {
+		fmt.Printf("  %04d_%s\n", migration.Version, migration.Name)
+	}
+}
@@ -10,12 +10,9 @@ import (
 	"strings"
 	"sync"
 	"time"
-)
 
-type AnalyzeRequest struct {
-	Username string `json:"username"`
-	Repo     string `json:"repo"`
-}
+	"github.com/immatheus/gitback/api"
+)
 
 type TestResult struct {
 	Duration     time.Duration
@@ -49,7 +46,7 @@ func main() {
 	// Parse repository name
 	parts := strings.Split(testRepo, "/")
 
-	request := AnalyzeRequest{
+	request := api.AnalyzeRequest{
 		Username: parts[0],
 		Repo:     parts[1],
 	}
@@ -70,7 +67,7 @@ func main() {
 	analyzeResults(results)
 }
 
-func performRequest(serverURL string, req AnalyzeRequest) TestResult {
+func performRequest(serverURL string, req api.AnalyzeRequest) TestResult {
 	start := time.Now()
 
 	jsonData, err := json.Marshal(req)
@@ -107,7 +104,7 @@ func performRequest(serverURL string, req AnalyzeRequest) TestResult {
 	}
 }
 
-func runConcurrentTest(serverURL string, req AnalyzeRequest, concurrency int) []TestResult {
+func runConcurrentTest(serverURL string, req api.AnalyzeRequest, concurrency int) []TestResult {
 	var wg sync.WaitGroup
 	results := make([]TestResult, concurrency)
 
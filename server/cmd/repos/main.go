@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	database "github.com/immatheus/gitback/databases"
+	"github.com/joho/godotenv"
+)
+
+const usage = "Usage: go run ./cmd/repos <feature|unfeature|hide|unhide> <owner/repo>"
+
+func main() {
+	godotenv.Load()
+
+	if len(os.Args) < 3 {
+		log.Fatal(usage)
+	}
+
+	username, repoName, ok := strings.Cut(os.Args[2], "/")
+	if !ok || username == "" || repoName == "" {
+		log.Fatal(usage)
+	}
+
+	if err := database.Open(os.Getenv("DATABASE_URL")); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	var err error
+	switch os.Args[1] {
+	case "feature", "unfeature":
+		err = database.SetRepoFeatured(username, repoName, os.Args[1] == "feature")
+	case "hide", "unhide":
+		err = database.SetRepoHidden(username, repoName, os.Args[1] == "hide")
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s %s/%s: %v", os.Args[1], username, repoName, err)
+	}
+
+	log.Printf("Ran %s on %s/%s", os.Args[1], username, repoName)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Column sizes of the contributors and commits tables, in characters
+const (
+	maxNameLength  = 255
+	maxEmailLength = 320
+)
+
+// GitHub noreply addresses look like 12345+login@users.noreply.github.com
+var noreplyEmailPattern = regexp.MustCompile(`^(?:\d+\+)?([^@]+)@users\.noreply\.github\.com$`)
+
+// ContributorIdentity resolves the key a contributor is stored under. Emails
+// identify people better than display names, GitHub noreply addresses are
+// reduced to the login so the old and new noreply formats match.
+func ContributorIdentity(name, email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if match := noreplyEmailPattern.FindStringSubmatch(email); match != nil {
+		return truncateColumn("github:"+match[1], maxEmailLength)
+	}
+	if email != "" {
+		return truncateColumn("email:"+email, maxEmailLength)
+	}
+	return truncateColumn("name:"+strings.ToLower(strings.TrimSpace(name)), maxEmailLength)
+}
+
+// commitAuthor is the author name a commit is stored under, cut to fit the
+// column since git doesn't limit names
+func commitAuthor(commit CommitStats) string {
+	return truncateColumn(commit.Author, maxNameLength)
+}
+
+// commitEmail is the author email a commit is stored under
+func commitEmail(commit CommitStats) string {
+	return truncateColumn(strings.ToLower(commit.AuthorEmail), maxEmailLength)
+}
+
+// truncateColumn cuts s to at most n characters
+func truncateColumn(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// chartDate is the date of a commit clamped to the time between 1970 and
+// now. Dates come from the author's clock, one broken commit would stretch
+// a chart over centuries.
+func chartDate(commit CommitStats, now int64) int64 {
+	return max(0, min(commit.Date, now))
+}
+
+// commitSHA is the hash a commit is stored under, the full one when known
+func commitSHA(commit CommitStats) string {
+	if commit.FullHash != "" {
+		return commit.FullHash
+	}
+	return commit.Hash
+}
+
+// commitMessage is the message a commit is stored under, the full one when
+// known
+func commitMessage(commit CommitStats) string {
+	if commit.FullMessage != "" {
+		return commit.FullMessage
+	}
+	return commit.Message
+}
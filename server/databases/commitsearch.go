@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCommitMatches = 50
+	MaxCommitMatches     = 200
+)
+
+// Orders of the commit search, relevance is the default
+const (
+	OrderRelevance = ""
+	OrderOldest    = "asc"
+	OrderNewest    = "desc"
+)
+
+// CommitSearchQuery searches the stored commit messages of one repo, zero
+// values don't filter
+type CommitSearchQuery struct {
+	Query string
+	// Author matches the author name, case insensitive
+	Author   string
+	From, To time.Time
+	Order    string
+
+	Limit, Offset int
+}
+
+// CommitMatch is a commit whose message matches a CommitSearchQuery
+type CommitMatch struct {
+	SHA          string `json:"sha"`
+	Author       string `json:"author"`
+	Date         int64  `json:"date"`
+	Added        int    `json:"added"`
+	Removed      int    `json:"removed"`
+	FilesTouched int    `json:"filesTouched"`
+	Message      string `json:"message"`
+	// Relevance of the match, only comparable within one search
+	Score float64 `json:"score"`
+}
+
+// commitSearchFilters builds the conditions of q that both backends share,
+// arg adds a query argument and returns its placeholder
+func commitSearchFilters(q CommitSearchQuery, arg func(interface{}) string) []string {
+	var conditions []string
+	if q.Author != "" {
+		conditions = append(conditions, "LOWER(c.author_name) = LOWER("+arg(q.Author)+")")
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "c.committed_at >= "+arg(q.From.UTC()))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "c.committed_at < "+arg(q.To.UTC()))
+	}
+	return conditions
+}
+
+// commitSearchOrder is the ORDER BY of q, rank is the expression that sorts
+// the best matches first
+func commitSearchOrder(q CommitSearchQuery, rank string) string {
+	switch q.Order {
+	case OrderOldest:
+		return "c.committed_at ASC, c.id ASC"
+	case OrderNewest:
+		return "c.committed_at DESC, c.id DESC"
+	}
+	// Among equally good matches the commit that introduced something first
+	return rank + ", c.committed_at ASC, c.id ASC"
+}
+
+// normalizeCommitSearch applies the default limit and checks the order
+func normalizeCommitSearch(q *CommitSearchQuery) error {
+	switch q.Order {
+	case OrderRelevance, OrderOldest, OrderNewest:
+	default:
+		return fmt.Errorf("unknown order %q", q.Order)
+	}
+	if q.Limit <= 0 || q.Limit > MaxCommitMatches {
+		q.Limit = DefaultCommitMatches
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return nil
+}
+
+// ftsQuery turns free text into an FTS5 query that matches commits
+// containing every word, quoting the words keeps FTS5 syntax out of it
+func ftsQuery(text string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ReplaceAll(text, `"`, " ")) {
+		words = append(words, `"`+word+`"`)
+	}
+	return strings.Join(words, " ")
+}
+
+// scanCommitMatches reads rows of sha, author, commit time, added, removed,
+// files touched, message and score
+func scanCommitMatches(rows *sql.Rows) ([]CommitMatch, error) {
+	defer rows.Close()
+
+	matches := []CommitMatch{}
+	for rows.Next() {
+		var match CommitMatch
+		var committedAt time.Time
+		err := rows.Scan(
+			&match.SHA,
+			&match.Author,
+			&committedAt,
+			&match.Added,
+			&match.Removed,
+			&match.FilesTouched,
+			&match.Message,
+			&match.Score,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan commit match: %w", err)
+		}
+		match.Date = committedAt.Unix()
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return matches, nil
+}
@@ -5,50 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"sort"
 	"time"
-
-	_ "github.com/lib/pq"
 )
 
-var db *sql.DB
-
-func Init(dsn string) error {
-	var err error
-	db, err = sql.Open("postgres", dsn)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Hour)
-
-	log.Printf("Database connection established")
-
-	go func() {
-		_, err := db.Exec(`
-			ALTER TABLE repos 
-			ADD COLUMN IF NOT EXISTS last_cached_at timestamp;
-		`)
-		if err != nil {
-			log.Printf("Failed to run migration for 'last_cached_at' column: %v", err)
-		}
-	}()
-	return nil
-}
-
-func Close() error {
-	if db != nil {
-		return db.Close()
-	}
-	return nil
-}
-
 type RepoData struct {
 	Username       string     `json:"username"`
 	RepoName       string     `json:"repoName"`
@@ -56,12 +15,15 @@ type RepoData struct {
 	TotalLines     int        `json:"totalLines"`
 	TotalRemovals  int        `json:"totalRemovals"`
 	Views          int        `json:"views"`
-	LinesHistogram []int      `json:"linesHistogram"` // 10 data points showing LOC over time
+	LinesHistogram []int      `json:"linesHistogram"` // LOC over time, HistogramPoints buckets of equal length
 	TotalStars     int        `json:"totalStars"`
 	TotalCommits   int        `json:"totalCommits"`
 	Language       string     `json:"language"`
 	Size           int        `json:"size"`
 	LastCachedAt   *time.Time `json:"lastCachedAt,omitempty"`
+	// How long the cached analysis stays fresh, picked from the repo's activity
+	CacheTTLSeconds *int `json:"cacheTtlSeconds,omitempty"`
+	Featured        bool `json:"featured"`
 }
 
 // we do this weird json names to minify the payload size, its small but it matters at scale
@@ -73,19 +35,27 @@ type CommitStats struct {
 	Removed           int    `json:"-,omitempty"`
 	Message           string `json:"m,omitempty"`
 	FilesTouchedCount int    `json:"f,omitempty"`
+	// Top level directories the commit touched, files in the root are left
+	// out. Only the contributor profiles need them, they are built during the
+	// analysis so the directories stay out of the payload.
+	Dirs []string `json:"-"`
+	// Seconds east of UTC of the author's clock, for the contributor profiles
+	UTCOffset int `json:"-"`
+
+	// Only needed to persist the commit, kept out of the payload
+	FullHash    string `json:"-"`
+	AuthorEmail string `json:"-"`
+	// Subject and body, Message is only the truncated subject
+	FullMessage string `json:"-"`
 }
 
-func SaveRepo(data RepoData) error {
-	if db == nil {
-		return fmt.Errorf("database not initialized")
-	}
-
+func (s *sqlStore) SaveRepo(data RepoData) error {
 	histogramJSON, err := json.Marshal(data.LinesHistogram)
 	if err != nil {
 		return fmt.Errorf("failed to marshal histogram: %w", err)
 	}
 
-	// PostgreSQL upsert using ON CONFLICT
+	// Upsert using ON CONFLICT, both Postgres and SQLite support it
 	query := `
 		INSERT INTO repos (
 			username, 
@@ -101,7 +71,7 @@ func SaveRepo(data RepoData) error {
 			size_kb,
 			last_cached_at,
 			updated_at
-		) VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $9, $10, $11, NOW())
+		) VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $9, $10, $11, CURRENT_TIMESTAMP)
 		ON CONFLICT (username, repo_name) 
 		DO UPDATE SET
 			total_additions = EXCLUDED.total_additions,
@@ -112,11 +82,11 @@ func SaveRepo(data RepoData) error {
 			total_commits = EXCLUDED.total_commits,
 			language = EXCLUDED.language,
 			size_kb = EXCLUDED.size_kb,
-			last_cached_at = EXCLUDED.last_cached_at,
-			updated_at = NOW()
+			last_cached_at = COALESCE(EXCLUDED.last_cached_at, repos.last_cached_at),
+			updated_at = CURRENT_TIMESTAMP
 	`
 
-	_, err = db.Exec(
+	_, err = s.db.Exec(
 		query,
 		data.Username,
 		data.RepoName,
@@ -139,18 +109,14 @@ func SaveRepo(data RepoData) error {
 	return nil
 }
 
-func IncrementViews(username, repoName string) error {
-	if db == nil {
-		return fmt.Errorf("database not initialized")
-	}
-
+func (s *sqlStore) IncrementViews(username, repoName string) error {
 	query := `
 		UPDATE repos 
 		SET views = views + 1 
 		WHERE username = $1 AND repo_name = $2
 	`
 
-	result, err := db.Exec(query, username, repoName)
+	result, err := s.db.Exec(query, username, repoName)
 	if err != nil {
 		return fmt.Errorf("failed to increment views: %w", err)
 	}
@@ -163,13 +129,9 @@ func IncrementViews(username, repoName string) error {
 	return nil
 }
 
-func GetRepo(username, repoName string) (*RepoData, error) {
-	if db == nil {
-		return nil, fmt.Errorf("database not initialized")
-	}
-
+func (s *sqlStore) GetRepo(username, repoName string) (*RepoData, error) {
 	query := `
-		SELECT username, repo_name, total_additions, total_lines, total_removals, lines_histogram
+		SELECT username, repo_name, total_additions, total_lines, total_removals, lines_histogram, total_stars
 		FROM repos
 		WHERE username = $1 AND repo_name = $2
 	`
@@ -177,13 +139,14 @@ func GetRepo(username, repoName string) (*RepoData, error) {
 	var data RepoData
 	var histogramJSON string
 
-	err := db.QueryRow(query, username, repoName).Scan(
+	err := s.db.QueryRow(query, username, repoName).Scan(
 		&data.Username,
 		&data.RepoName,
 		&data.TotalAdditions,
 		&data.TotalLines,
 		&data.TotalRemovals,
 		&histogramJSON,
+		&data.TotalStars,
 	)
 
 	if err == sql.ErrNoRows {
@@ -201,113 +164,159 @@ func GetRepo(username, repoName string) (*RepoData, error) {
 	return &data, nil
 }
 
-func GetTopRepos() ([]RepoData, error) {
-	if db == nil {
-		return nil, fmt.Errorf("database not initialized")
-	}
-
-	query := `
-		SELECT username, repo_name, total_additions, total_lines, total_removals, views, lines_histogram, total_stars, total_commits
-		FROM repos
-		WHERE repo_name != 'linux'
-		AND total_lines > 0
-		AND total_commits > 1
-		ORDER BY total_lines DESC
-		LIMIT 100
-	`
+// HistogramPoints is how many points of the lines histogram are stored,
+// ResampleHistogram reduces them for smaller charts
+const HistogramPoints = 60
 
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query top repos: %w", err)
+// CalculateLinesHistogram splits the time from the first to the last commit
+// into points equally long buckets, every point is the line count at the end
+// of its bucket. See chartDate for the dates it uses.
+func CalculateLinesHistogram(commits []CommitStats, points int) []int {
+	histogram := make([]int, points)
+	if len(commits) == 0 || points <= 0 {
+		return histogram
 	}
-	defer rows.Close()
 
-	var repos []RepoData
-	for rows.Next() {
-		var data RepoData
-		var histogramJSON string
+	now := time.Now().Unix()
+	first, last := chartDate(commits[0], now), chartDate(commits[0], now)
+	for _, commit := range commits {
+		first = min(first, chartDate(commit, now))
+		last = max(last, chartDate(commit, now))
+	}
 
-		err := rows.Scan(
-			&data.Username,
-			&data.RepoName,
-			&data.TotalAdditions,
-			&data.TotalLines,
-			&data.TotalRemovals,
-			&data.Views,
-			&histogramJSON,
-			&data.TotalStars,
-			&data.TotalCommits,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan repo row: %w", err)
+	span := last - first
+	for _, commit := range commits {
+		// A history without a span is flat at its final count
+		bucket := 0
+		if span > 0 {
+			bucket = int((chartDate(commit, now) - first) * int64(points) / span)
 		}
-
-		// Parse histogram JSON
-		if err := json.Unmarshal([]byte(histogramJSON), &data.LinesHistogram); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal histogram: %w", err)
+		if bucket >= points {
+			bucket = points - 1
 		}
-
-		repos = append(repos, data)
+		histogram[bucket] += commit.Added - commit.Removed
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+	for i := 1; i < points; i++ {
+		histogram[i] += histogram[i-1]
 	}
 
-	return repos, nil
+	return histogram
 }
 
-func CalculateLinesHistogram(commits []CommitStats, points int) []int {
-	if len(commits) == 0 {
-		return make([]int, points)
+// ResampleHistogram reduces a lines histogram to points, every point takes
+// the line count at the end of the stored buckets it covers. Histograms
+// with fewer points are returned as they are.
+func ResampleHistogram(histogram []int, points int) []int {
+	if points <= 0 || len(histogram) <= points {
+		return histogram
 	}
 
-	// Sort commits by date (oldest first)
-	sortedCommits := make([]CommitStats, len(commits))
-	copy(sortedCommits, commits)
-	sort.Slice(sortedCommits, func(i, j int) bool {
-		return sortedCommits[i].Date < sortedCommits[j].Date
-	})
+	resampled := make([]int, points)
+	for i := range resampled {
+		end := ((i+1)*len(histogram)+points-1)/points - 1
+		resampled[i] = histogram[end]
+	}
+	return resampled
+}
 
-	histogram := make([]int, points)
-	commitsPerBucket := len(sortedCommits) / points
-	if commitsPerBucket == 0 {
-		commitsPerBucket = 1
+// BackfillHistograms recomputes the lines histograms saved before they were
+// bucketed by time from the stored commits, those have 10 points that each
+// cover the same number of commits. Repos without stored commits keep theirs
+// until they are analyzed again.
+func (s *sqlStore) BackfillHistograms() (int, error) {
+	rows, err := s.db.Query(`SELECT username, repo_name, lines_histogram FROM repos`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query histograms: %w", err)
 	}
 
-	totalLines := 0
-	bucketIndex := 0
+	type repoKey struct{ username, repoName string }
+	var outdated []repoKey
+	for rows.Next() {
+		var key repoKey
+		var histogramJSON string
+		if err := rows.Scan(&key.username, &key.repoName, &histogramJSON); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan histogram: %w", err)
+		}
+		var histogram []int
+		if err := json.Unmarshal([]byte(histogramJSON), &histogram); err != nil || len(histogram) != HistogramPoints {
+			outdated = append(outdated, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %w", err)
+	}
 
-	for i, commit := range sortedCommits {
-		totalLines += commit.Added - commit.Removed
+	updated := 0
+	for _, key := range outdated {
+		commits, err := s.storedCommitLines(key.username, key.repoName)
+		if err != nil {
+			return updated, err
+		}
+		if len(commits) == 0 {
+			continue
+		}
 
-		// Save snapshot at each bucket boundary
-		if (i+1)%commitsPerBucket == 0 && bucketIndex < points {
-			histogram[bucketIndex] = totalLines
-			bucketIndex++
+		histogramJSON, err := json.Marshal(CalculateLinesHistogram(commits, HistogramPoints))
+		if err != nil {
+			return updated, fmt.Errorf("failed to marshal histogram: %w", err)
+		}
+		_, err = s.db.Exec(`
+			UPDATE repos
+			SET lines_histogram = $3
+			WHERE username = $1 AND repo_name = $2
+		`, key.username, key.repoName, string(histogramJSON))
+		if err != nil {
+			return updated, fmt.Errorf("failed to update histogram of %s/%s: %w", key.username, key.repoName, err)
 		}
+		updated++
 	}
 
-	// Fill remaining buckets with final total
-	for i := bucketIndex; i < points; i++ {
-		histogram[i] = totalLines
+	return updated, nil
+}
+
+// storedCommitLines reads the dates and line changes of the stored commits
+// of a repo, all CalculateLinesHistogram needs
+func (s *sqlStore) storedCommitLines(username, repoName string) ([]CommitStats, error) {
+	rows, err := s.db.Query(`
+		SELECT committed_at, added, removed
+		FROM commits
+		WHERE username = $1 AND repo_name = $2
+	`, username, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commits: %w", err)
 	}
+	defer rows.Close()
 
-	return histogram
-}
+	var commits []CommitStats
+	for rows.Next() {
+		var committedAt time.Time
+		var commit CommitStats
+		if err := rows.Scan(&committedAt, &commit.Added, &commit.Removed); err != nil {
+			return nil, fmt.Errorf("failed to scan commit: %w", err)
+		}
+		commit.Date = committedAt.Unix()
+		commits = append(commits, commit)
+	}
 
-func UpdateLastCachedAt(username, repoName string) error {
-	if db == nil {
-		return fmt.Errorf("database not initialized")
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
+	return commits, nil
+}
 
+// UpdateLastCachedAt records that the repo was just cached and for how long
+// the cached analysis stays fresh
+func (s *sqlStore) UpdateLastCachedAt(username, repoName string, ttl time.Duration) error {
 	query := `
 		UPDATE repos 
-		SET last_cached_at = NOW() 
+		SET last_cached_at = CURRENT_TIMESTAMP, cache_ttl_seconds = $3
 		WHERE username = $1 AND repo_name = $2
 	`
 
-	result, err := db.Exec(query, username, repoName)
+	result, err := s.db.Exec(query, username, repoName, int(ttl.Seconds()))
 	if err != nil {
 		return fmt.Errorf("failed to update last cached timestamp: %w", err)
 	}
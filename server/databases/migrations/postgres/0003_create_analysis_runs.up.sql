@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS analysis_runs (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    repo_name VARCHAR(255) NOT NULL,
+    head_sha VARCHAR(40) NOT NULL DEFAULT '',
+    total_additions INTEGER NOT NULL DEFAULT 0,
+    total_removals INTEGER NOT NULL DEFAULT 0,
+    total_lines INTEGER NOT NULL DEFAULT 0,
+    total_commits INTEGER NOT NULL DEFAULT 0,
+    total_contributors INTEGER NOT NULL DEFAULT 0,
+    total_stars INTEGER NOT NULL DEFAULT 0,
+    lines_histogram JSONB NOT NULL,
+    analyzed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_analysis_runs_repo ON analysis_runs(username, repo_name, analyzed_at);
@@ -0,0 +1 @@
+ALTER TABLE repos ADD COLUMN IF NOT EXISTS last_cached_at TIMESTAMP;
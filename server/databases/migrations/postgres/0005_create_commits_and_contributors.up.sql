@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS contributors (
+    id SERIAL PRIMARY KEY,
+    identity VARCHAR(320) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(320) NOT NULL DEFAULT '',
+    first_commit_at TIMESTAMP,
+    last_commit_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_contributor_identity UNIQUE (identity)
+);
+
+CREATE TABLE IF NOT EXISTS commits (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    repo_name VARCHAR(255) NOT NULL,
+    sha VARCHAR(40) NOT NULL,
+    contributor_id INTEGER NOT NULL REFERENCES contributors(id),
+    author_name VARCHAR(255) NOT NULL,
+    committed_at TIMESTAMP NOT NULL,
+    added INTEGER NOT NULL DEFAULT 0,
+    removed INTEGER NOT NULL DEFAULT 0,
+    files_touched INTEGER NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    CONSTRAINT unique_commit UNIQUE (username, repo_name, sha)
+);
+
+CREATE INDEX IF NOT EXISTS idx_commits_repo_date ON commits(username, repo_name, committed_at);
+CREATE INDEX IF NOT EXISTS idx_commits_contributor ON commits(contributor_id);
@@ -0,0 +1 @@
+ALTER TABLE repos DROP COLUMN cache_ttl_seconds;
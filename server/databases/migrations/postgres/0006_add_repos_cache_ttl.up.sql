@@ -0,0 +1 @@
+ALTER TABLE repos ADD COLUMN IF NOT EXISTS cache_ttl_seconds INTEGER;
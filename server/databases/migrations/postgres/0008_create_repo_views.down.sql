@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS repo_views_hourly;
+DROP TABLE IF EXISTS repo_view_events;
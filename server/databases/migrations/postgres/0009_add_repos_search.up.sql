@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_repos_full_name_trgm ON repos
+    USING gin (LOWER(username || '/' || repo_name) gin_trgm_ops);
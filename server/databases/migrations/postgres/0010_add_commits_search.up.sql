@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_commits_message_fts ON commits
+    USING gin (to_tsvector('english', message));
@@ -0,0 +1,3 @@
+-- The language filter compares LOWER(language), the plain index never matched
+DROP INDEX IF EXISTS idx_repos_language;
+CREATE INDEX IF NOT EXISTS idx_repos_language_lower ON repos(LOWER(language));
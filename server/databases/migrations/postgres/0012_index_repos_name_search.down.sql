@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_repos_repo_name_trgm;
@@ -0,0 +1,4 @@
+-- Every branch of the search WHERE needs an index for a bitmap OR instead of
+-- a full scan, language matches use idx_repos_language_lower
+CREATE INDEX IF NOT EXISTS idx_repos_repo_name_trgm ON repos
+    USING gin (LOWER(repo_name) gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- Stargazers already paged through, sampled pages keep fewer star points
+ALTER TABLE repos ADD COLUMN IF NOT EXISTS stargazers_paged INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE analysis_runs ALTER COLUMN head_sha TYPE VARCHAR(40);
+ALTER TABLE commits ALTER COLUMN sha TYPE VARCHAR(40);
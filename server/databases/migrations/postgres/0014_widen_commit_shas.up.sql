@@ -0,0 +1,3 @@
+-- SHA-256 repositories have 64 character hashes
+ALTER TABLE commits ALTER COLUMN sha TYPE VARCHAR(64);
+ALTER TABLE analysis_runs ALTER COLUMN head_sha TYPE VARCHAR(64);
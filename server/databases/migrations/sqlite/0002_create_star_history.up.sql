@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS star_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL,
+    repo_name VARCHAR(255) NOT NULL,
+    starred_at TIMESTAMP NOT NULL,
+    stars INTEGER NOT NULL,
+    CONSTRAINT unique_star_point UNIQUE (username, repo_name, stars)
+);
+
+CREATE INDEX IF NOT EXISTS idx_star_history_repo ON star_history(username, repo_name, starred_at);
@@ -0,0 +1 @@
+ALTER TABLE repos DROP COLUMN last_cached_at;
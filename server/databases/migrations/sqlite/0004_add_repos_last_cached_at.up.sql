@@ -0,0 +1 @@
+ALTER TABLE repos ADD COLUMN last_cached_at TIMESTAMP;
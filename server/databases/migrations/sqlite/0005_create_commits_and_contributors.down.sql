@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS commits;
+DROP TABLE IF EXISTS contributors;
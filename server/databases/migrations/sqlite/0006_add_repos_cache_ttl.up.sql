@@ -0,0 +1 @@
+ALTER TABLE repos ADD COLUMN cache_ttl_seconds INTEGER;
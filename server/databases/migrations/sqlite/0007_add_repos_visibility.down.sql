@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_repos_language;
+ALTER TABLE repos DROP COLUMN hidden;
+ALTER TABLE repos DROP COLUMN featured;
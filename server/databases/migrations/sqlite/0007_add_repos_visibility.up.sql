@@ -0,0 +1,7 @@
+ALTER TABLE repos ADD COLUMN featured BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE repos ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The linux kernel was filtered out of the top repos by name before
+UPDATE repos SET hidden = TRUE WHERE repo_name = 'linux';
+
+CREATE INDEX IF NOT EXISTS idx_repos_language ON repos(language);
@@ -0,0 +1,20 @@
+-- One row per client, repo and hour, rolled up into repo_views_hourly once
+-- the hour is over
+CREATE TABLE IF NOT EXISTS repo_view_events (
+    username VARCHAR(255) NOT NULL,
+    repo_name VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    client_hash VARCHAR(64) NOT NULL,
+    CONSTRAINT unique_repo_view_event UNIQUE (username, repo_name, hour, client_hash)
+);
+
+CREATE TABLE IF NOT EXISTS repo_views_hourly (
+    username VARCHAR(255) NOT NULL,
+    repo_name VARCHAR(255) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT unique_repo_views_hour UNIQUE (username, repo_name, hour)
+);
+
+CREATE INDEX IF NOT EXISTS idx_repo_view_events_hour ON repo_view_events(hour);
+CREATE INDEX IF NOT EXISTS idx_repo_views_hourly_hour ON repo_views_hourly(hour);
@@ -0,0 +1,2 @@
+-- SQLite has no trigram index, fuzzy matches are ranked in Go
+CREATE INDEX IF NOT EXISTS idx_repos_full_name ON repos(LOWER(username || '/' || repo_name));
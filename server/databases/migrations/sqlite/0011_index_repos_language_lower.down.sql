@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_repos_language_lower;
+CREATE INDEX IF NOT EXISTS idx_repos_language ON repos(language);
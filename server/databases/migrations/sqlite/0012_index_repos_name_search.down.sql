@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_repos_full_name ON repos(LOWER(username || '/' || repo_name));
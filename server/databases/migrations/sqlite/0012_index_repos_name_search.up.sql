@@ -0,0 +1,2 @@
+-- Search ranks every repo in Go, the name index was never used
+DROP INDEX IF EXISTS idx_repos_full_name;
@@ -0,0 +1,3 @@
+-- SHA-256 repositories have 64 character hashes, SQLite doesn't enforce
+-- VARCHAR lengths so commits.sha and analysis_runs.head_sha already fit them
+SELECT 1;
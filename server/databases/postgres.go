@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// migrationLockID is the key of the advisory lock that keeps concurrently
+// starting instances from running the same migrations twice
+const migrationLockID = 4839201457
+
+type postgresStore struct {
+	*sqlStore
+}
+
+func newPostgresStore(dsn string) (*postgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(time.Hour)
+
+	log.Printf("Database connection established")
+
+	return &postgresStore{
+		sqlStore: &sqlStore{
+			db:             db,
+			migrationsDir:  "migrations/postgres",
+			lockMigrations: lockPostgresMigrations,
+			lockTx:         lockPostgresTx,
+			unixTime: func(column string) string {
+				return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+			},
+		},
+	}, nil
+}
+
+// lockPostgresMigrations takes a session level advisory lock, it is held by
+// the connection until released so every instance migrates one at a time
+func lockPostgresMigrations(conn *sql.Conn) (func(), error) {
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+// lockPostgresTx takes a transaction level advisory lock, it is released
+// when tx commits or rolls back
+func lockPostgresTx(tx *sql.Tx, key int64) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, key)
+	return err
+}
+
+// SaveCommits replaces the stored commits of a repository and upserts their
+// contributors. Rows are streamed with COPY into a temporary table first so
+// even 50k commits are a handful of round trips.
+func (s *postgresStore) SaveCommits(username, repoName string, commits []CommitStats) error {
+	start := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE TEMP TABLE tmp_commits (
+			sha VARCHAR(64) NOT NULL,
+			identity VARCHAR(320) NOT NULL,
+			author_name VARCHAR(255) NOT NULL,
+			email VARCHAR(320) NOT NULL,
+			committed_at TIMESTAMP NOT NULL,
+			added INTEGER NOT NULL,
+			removed INTEGER NOT NULL,
+			files_touched INTEGER NOT NULL,
+			message TEXT NOT NULL
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create temp table: %w", err)
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("tmp_commits",
+		"sha", "identity", "author_name", "email", "committed_at", "added", "removed", "files_touched", "message"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy: %w", err)
+	}
+
+	for _, commit := range commits {
+		sha := commitSHA(commit)
+		_, err := stmt.Exec(
+			sha,
+			ContributorIdentity(commit.Author, commit.AuthorEmail),
+			commitAuthor(commit),
+			commitEmail(commit),
+			time.Unix(commit.Date, 0).UTC(),
+			commit.Added,
+			commit.Removed,
+			commit.FilesTouchedCount,
+			commitMessage(commit),
+		)
+		if err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy commit %s: %w", sha, err)
+		}
+	}
+
+	// Flush the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to flush commits: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("failed to close copy: %w", err)
+	}
+
+	// The most recent name and email win, contributors change them over time
+	_, err = tx.Exec(`
+		INSERT INTO contributors (identity, name, email, first_commit_at, last_commit_at, updated_at)
+		SELECT
+			identity,
+			(array_agg(author_name ORDER BY committed_at DESC))[1],
+			(array_agg(email ORDER BY committed_at DESC))[1],
+			MIN(committed_at),
+			MAX(committed_at),
+			CURRENT_TIMESTAMP
+		FROM tmp_commits
+		GROUP BY identity
+		ON CONFLICT (identity)
+		DO UPDATE SET
+			name = CASE WHEN EXCLUDED.last_commit_at >= contributors.last_commit_at
+				THEN EXCLUDED.name ELSE contributors.name END,
+			email = CASE WHEN EXCLUDED.last_commit_at >= contributors.last_commit_at
+				THEN EXCLUDED.email ELSE contributors.email END,
+			first_commit_at = LEAST(contributors.first_commit_at, EXCLUDED.first_commit_at),
+			last_commit_at = GREATEST(contributors.last_commit_at, EXCLUDED.last_commit_at),
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to upsert contributors: %w", err)
+	}
+
+	// History can be rewritten between refreshes, so the set is replaced
+	if _, err := tx.Exec(`DELETE FROM commits WHERE username = $1 AND repo_name = $2`, username, repoName); err != nil {
+		return fmt.Errorf("failed to delete old commits: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO commits (
+			username,
+			repo_name,
+			sha,
+			contributor_id,
+			author_name,
+			committed_at,
+			added,
+			removed,
+			files_touched,
+			message
+		)
+		SELECT $1, $2, t.sha, c.id, t.author_name, t.committed_at, t.added, t.removed, t.files_touched, t.message
+		FROM tmp_commits t
+		JOIN contributors c ON c.identity = t.identity
+		ON CONFLICT (username, repo_name, sha) DO NOTHING
+	`, username, repoName)
+	if err != nil {
+		return fmt.Errorf("failed to insert commits: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit commits: %w", err)
+	}
+
+	log.Printf("Saved %d commits for %s/%s to database (took %v)", len(commits), username, repoName, time.Since(start))
+	return nil
+}
+
+// SearchRepos finds analyzed repos by a prefix of their name or repo name,
+// by trigram similarity for typos, or by language
+func (s *postgresStore) SearchRepos(query string, limit int) ([]RepoMatch, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	rows, err := s.db.Query(`
+		SELECT username, repo_name, COALESCE(language, ''), COALESCE(total_stars, 0), total_lines,
+			GREATEST(similarity(LOWER(username || '/' || repo_name), $1), similarity(LOWER(repo_name), $1)) AS score
+		FROM repos
+		WHERE hidden = FALSE AND (
+			LOWER(username || '/' || repo_name) LIKE $2 ESCAPE '\'
+			OR LOWER(repo_name) LIKE $2 ESCAPE '\'
+			OR LOWER(username || '/' || repo_name) % $1
+			OR LOWER(repo_name) % $1
+			OR LOWER(language) = $1
+		)
+		ORDER BY
+			CASE
+				WHEN LOWER(username || '/' || repo_name) = $1 OR LOWER(repo_name) = $1 THEN 0
+				WHEN LOWER(username || '/' || repo_name) LIKE $2 ESCAPE '\' OR LOWER(repo_name) LIKE $2 ESCAPE '\' THEN 1
+				ELSE 2
+			END,
+			score DESC,
+			COALESCE(total_stars, 0) DESC
+		LIMIT $3
+	`, query, likePrefix(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search repos: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []RepoMatch{}
+	for rows.Next() {
+		var match RepoMatch
+		if err := rows.Scan(&match.Username, &match.RepoName, &match.Language, &match.TotalStars, &match.TotalLines, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan repo match: %w", err)
+		}
+		if matchKind(query, match.Username, match.RepoName) == matchExact {
+			match.Score = 1
+		}
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return matches, nil
+}
+
+// SearchCommits searches the commit messages of a repo with the English full
+// text index, q.Query takes web search syntax like "quoted phrases" and -not
+func (s *postgresStore) SearchCommits(username, repoName string, q CommitSearchQuery) ([]CommitMatch, error) {
+	if err := normalizeCommitSearch(&q); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{username, repoName, q.Query}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := append([]string{
+		"c.username = $1",
+		"c.repo_name = $2",
+		"to_tsvector('english', c.message) @@ websearch_to_tsquery('english', $3)",
+	}, commitSearchFilters(q, arg)...)
+
+	query := fmt.Sprintf(`
+		SELECT c.sha, c.author_name, c.committed_at, c.added, c.removed, c.files_touched, c.message,
+			ts_rank(to_tsvector('english', c.message), websearch_to_tsquery('english', $3)) AS score
+		FROM commits c
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, strings.Join(conditions, " AND "), commitSearchOrder(q, "score DESC"),
+		arg(q.Limit), arg(q.Offset))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search commits: %w", err)
+	}
+	return scanCommitMatches(rows)
+}
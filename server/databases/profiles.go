@@ -0,0 +1,168 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+	"time"
+)
+
+// Directories listed per contributor
+const topDirectories = 5
+
+// ContributorProfile sums up the commits of one author of a repository.
+// Authors are told apart by name like the contributor count of an analysis,
+// hours and days are in the timezone each commit was authored in.
+type ContributorProfile struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Commits     int    `json:"commits"`
+	Added       int    `json:"added"`
+	Removed     int    `json:"removed"`
+	FirstCommit int64  `json:"firstCommit"`
+	LastCommit  int64  `json:"lastCommit"`
+	// Days with at least one commit, and the most of them in a row
+	ActiveDays    int `json:"activeDays"`
+	LongestStreak int `json:"longestStreak"`
+	// Commits per hour of the day, PreferredHour has the most
+	Hours          [24]int          `json:"hours"`
+	PreferredHour  int              `json:"preferredHour"`
+	TopDirectories []DirectoryStats `json:"topDirectories"`
+	// Share of all commits and of all added and removed lines, 0 to 1
+	CommitShare float64 `json:"commitShare"`
+	LineShare   float64 `json:"lineShare"`
+}
+
+// DirectoryStats counts the commits of a contributor to a top level directory
+type DirectoryStats struct {
+	Dir     string `json:"dir"`
+	Commits int    `json:"commits"`
+}
+
+// ContributorID is the stable id of an author in the contributor endpoints
+func ContributorID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:6])
+}
+
+// CalculateContributors builds the profile of every author, most commits
+// first
+func CalculateContributors(commits []CommitStats) []ContributorProfile {
+	type author struct {
+		profile *ContributorProfile
+		days    map[int64]bool
+		dirs    map[string]int
+	}
+
+	authors := make(map[string]*author)
+	var order []*author
+	totalLines := 0
+	for _, commit := range commits {
+		a, ok := authors[commit.Author]
+		if !ok {
+			a = &author{
+				profile: &ContributorProfile{
+					ID:          ContributorID(commit.Author),
+					Name:        commit.Author,
+					FirstCommit: commit.Date,
+					LastCommit:  commit.Date,
+				},
+				days: make(map[int64]bool),
+				dirs: make(map[string]int),
+			}
+			authors[commit.Author] = a
+			order = append(order, a)
+		}
+
+		p := a.profile
+		p.Commits++
+		p.Added += commit.Added
+		p.Removed += commit.Removed
+		if commit.Date < p.FirstCommit {
+			p.FirstCommit = commit.Date
+		}
+		if commit.Date > p.LastCommit {
+			p.LastCommit = commit.Date
+		}
+		local := commit.Date + int64(commit.UTCOffset)
+		p.Hours[time.Unix(local, 0).UTC().Hour()]++
+		a.days[floorDiv(local, 86400)] = true
+		for _, dir := range commit.Dirs {
+			a.dirs[dir]++
+		}
+		totalLines += commit.Added + commit.Removed
+	}
+
+	profiles := make([]ContributorProfile, 0, len(order))
+	for _, a := range order {
+		p := a.profile
+		p.ActiveDays = len(a.days)
+		p.LongestStreak = longestStreak(a.days)
+		for hour, count := range p.Hours {
+			if count > p.Hours[p.PreferredHour] {
+				p.PreferredHour = hour
+			}
+		}
+		p.TopDirectories = topDirs(a.dirs)
+		p.CommitShare = share(p.Commits, len(commits))
+		p.LineShare = share(p.Added+p.Removed, totalLines)
+		profiles = append(profiles, *p)
+	}
+
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].Commits > profiles[j].Commits
+	})
+	return profiles
+}
+
+func longestStreak(days map[int64]bool) int {
+	longest := 0
+	for day := range days {
+		// Only count from the first day of every streak
+		if days[day-1] {
+			continue
+		}
+		streak := 1
+		for days[day+int64(streak)] {
+			streak++
+		}
+		if streak > longest {
+			longest = streak
+		}
+	}
+	return longest
+}
+
+func topDirs(dirs map[string]int) []DirectoryStats {
+	stats := make([]DirectoryStats, 0, len(dirs))
+	for dir, commits := range dirs {
+		stats = append(stats, DirectoryStats{Dir: dir, Commits: commits})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Commits != stats[j].Commits {
+			return stats[i].Commits > stats[j].Commits
+		}
+		return stats[i].Dir < stats[j].Dir
+	})
+	if len(stats) > topDirectories {
+		stats = stats[:topDirectories]
+	}
+	return stats
+}
+
+func share(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 10000
+}
+
+// floorDiv divides rounding down, so dates before 1970 fall on the right day
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
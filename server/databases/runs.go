@@ -0,0 +1,118 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AnalysisRun is a snapshot of a single analysis, kept so refreshes can be
+// compared with each other instead of overwriting the repos row
+type AnalysisRun struct {
+	HeadSHA           string    `json:"headSha"`
+	TotalAdditions    int       `json:"totalAdditions"`
+	TotalRemovals     int       `json:"totalRemovals"`
+	TotalLines        int       `json:"totalLines"`
+	TotalCommits      int       `json:"totalCommits"`
+	TotalContributors int       `json:"totalContributors"`
+	TotalStars        int       `json:"totalStars"`
+	LinesHistogram    []int     `json:"linesHistogram"`
+	AnalyzedAt        time.Time `json:"analyzedAt"`
+}
+
+func (s *sqlStore) SaveAnalysisRun(username, repoName string, run AnalysisRun) error {
+	histogramJSON, err := json.Marshal(run.LinesHistogram)
+	if err != nil {
+		return fmt.Errorf("failed to marshal histogram: %w", err)
+	}
+
+	query := `
+		INSERT INTO analysis_runs (
+			username,
+			repo_name,
+			head_sha,
+			total_additions,
+			total_removals,
+			total_lines,
+			total_commits,
+			total_contributors,
+			total_stars,
+			lines_histogram,
+			analyzed_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP)
+	`
+
+	_, err = s.db.Exec(
+		query,
+		username,
+		repoName,
+		run.HeadSHA,
+		run.TotalAdditions,
+		run.TotalRemovals,
+		run.TotalLines,
+		run.TotalCommits,
+		run.TotalContributors,
+		run.TotalStars,
+		string(histogramJSON),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save analysis run: %w", err)
+	}
+
+	return nil
+}
+
+// GetAnalysisRuns returns the most recent runs of a repository, oldest first
+func (s *sqlStore) GetAnalysisRuns(username, repoName string, limit int) ([]AnalysisRun, error) {
+	query := `
+		SELECT head_sha, total_additions, total_removals, total_lines, total_commits,
+			total_contributors, total_stars, lines_histogram, analyzed_at
+		FROM (
+			SELECT *
+			FROM analysis_runs
+			WHERE username = $1 AND repo_name = $2
+			ORDER BY analyzed_at DESC, id DESC
+			LIMIT $3
+		) recent
+		ORDER BY analyzed_at ASC, id ASC
+	`
+
+	rows, err := s.db.Query(query, username, repoName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query analysis runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []AnalysisRun{}
+	for rows.Next() {
+		var run AnalysisRun
+		var histogramJSON string
+
+		err := rows.Scan(
+			&run.HeadSHA,
+			&run.TotalAdditions,
+			&run.TotalRemovals,
+			&run.TotalLines,
+			&run.TotalCommits,
+			&run.TotalContributors,
+			&run.TotalStars,
+			&histogramJSON,
+			&run.AnalyzedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan analysis run: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(histogramJSON), &run.LinesHistogram); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal histogram: %w", err)
+		}
+
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Trigram similarity a fuzzy match needs, the pg_trgm default
+const similarityThreshold = 0.3
+
+// RepoMatch is an analyzed repo found by SearchRepos
+type RepoMatch struct {
+	Username   string `json:"username"`
+	RepoName   string `json:"repoName"`
+	Language   string `json:"language"`
+	TotalStars int    `json:"totalStars"`
+	TotalLines int    `json:"totalLines"`
+	// How well the name matches, 1 for an exact match
+	Score float64 `json:"score"`
+}
+
+// Match kinds, lower ranks first
+const (
+	matchExact = iota
+	matchPrefix
+	matchFuzzy
+)
+
+// matchKind ranks exact names before prefixes of either the full name or the
+// repo name, so "react" finds facebook/react before reactjs/react-docs
+func matchKind(query, username, repoName string) int {
+	full := strings.ToLower(username + "/" + repoName)
+	name := strings.ToLower(repoName)
+	switch {
+	case full == query || name == query:
+		return matchExact
+	case strings.HasPrefix(full, query) || strings.HasPrefix(name, query):
+		return matchPrefix
+	}
+	return matchFuzzy
+}
+
+// likePrefix escapes a query for a LIKE prefix pattern with ESCAPE '\'
+func likePrefix(query string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(query) + "%"
+}
+
+// rankMatches orders matches by kind, then score and stars, and cuts them
+// to limit
+func rankMatches(query string, matches []RepoMatch, limit int) []RepoMatch {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if ka, kb := matchKind(query, a.Username, a.RepoName), matchKind(query, b.Username, b.RepoName); ka != kb {
+			return ka < kb
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.TotalStars > b.TotalStars
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// trigrams splits text into the padded trigrams of its words like pg_trgm
+func trigrams(text string) map[string]bool {
+	grams := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams[string(padded[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+// trigramSimilarity is the share of trigrams a and b have in common, like
+// pg_trgm's similarity()
+func trigramSimilarity(a, b string) float64 {
+	ga, gb := trigrams(a), trigrams(b)
+	if len(ga) == 0 || len(gb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for gram := range ga {
+		if gb[gram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ga)+len(gb)-common)
+}
+
+// nameSimilarity compares a query with the full name and with the repo name
+// alone, queries usually only name the repo
+func nameSimilarity(query, username, repoName string) float64 {
+	return max(trigramSimilarity(query, username+"/"+repoName), trigramSimilarity(query, repoName))
+}
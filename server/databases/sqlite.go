@@ -0,0 +1,263 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore is an embedded database for local development, it needs no
+// server and keeps everything in a single file
+type sqliteStore struct {
+	*sqlStore
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite DSN needs a file path, e.g. sqlite://gitback.db")
+	}
+
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	// SQLite allows a single writer, one connection avoids busy errors and
+	// keeps :memory: databases from splitting into one per connection
+	db.SetMaxOpenConns(1)
+
+	log.Printf("SQLite database opened at %s", path)
+
+	return &sqliteStore{
+		sqlStore: &sqlStore{
+			db:             db,
+			migrationsDir:  "migrations/sqlite",
+			lockMigrations: lockSQLiteMigrations,
+			lockTx:         lockSQLiteTx,
+			unixTime: func(column string) string {
+				return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+			},
+		},
+	}, nil
+}
+
+// lockSQLiteMigrations is a no-op, the store only has one connection and
+// SQLite's file lock already serializes writers across processes
+func lockSQLiteMigrations(conn *sql.Conn) (func(), error) {
+	return func() {}, nil
+}
+
+// lockSQLiteTx is a no-op for the same reason, a second writer waits for
+// tx to end
+func lockSQLiteTx(tx *sql.Tx, key int64) error {
+	return nil
+}
+
+// SaveCommits replaces the stored commits of a repository. SQLite has no COPY,
+// so rows go through prepared statements inside a single transaction.
+func (s *sqliteStore) SaveCommits(username, repoName string, commits []CommitStats) error {
+	start := time.Now()
+
+	type contributor struct {
+		name, email   string
+		first, latest int64
+	}
+	contributors := make(map[string]*contributor)
+	for _, commit := range commits {
+		identity := ContributorIdentity(commit.Author, commit.AuthorEmail)
+		c, ok := contributors[identity]
+		if !ok {
+			contributors[identity] = &contributor{
+				name:   commitAuthor(commit),
+				email:  commitEmail(commit),
+				first:  commit.Date,
+				latest: commit.Date,
+			}
+			continue
+		}
+		if commit.Date < c.first {
+			c.first = commit.Date
+		}
+		if commit.Date >= c.latest {
+			c.latest = commit.Date
+			c.name = commitAuthor(commit)
+			c.email = commitEmail(commit)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(`
+		INSERT INTO contributors (identity, name, email, first_commit_at, last_commit_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (identity)
+		DO UPDATE SET
+			name = CASE WHEN EXCLUDED.last_commit_at >= contributors.last_commit_at
+				THEN EXCLUDED.name ELSE contributors.name END,
+			email = CASE WHEN EXCLUDED.last_commit_at >= contributors.last_commit_at
+				THEN EXCLUDED.email ELSE contributors.email END,
+			first_commit_at = MIN(contributors.first_commit_at, EXCLUDED.first_commit_at),
+			last_commit_at = MAX(contributors.last_commit_at, EXCLUDED.last_commit_at),
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare contributor upsert: %w", err)
+	}
+	defer upsert.Close()
+
+	for identity, c := range contributors {
+		_, err := upsert.Exec(identity, c.name, c.email, time.Unix(c.first, 0).UTC(), time.Unix(c.latest, 0).UTC())
+		if err != nil {
+			return fmt.Errorf("failed to upsert contributor %s: %w", identity, err)
+		}
+	}
+
+	// History can be rewritten between refreshes, so the set is replaced
+	if _, err := tx.Exec(`DELETE FROM commits WHERE username = $1 AND repo_name = $2`, username, repoName); err != nil {
+		return fmt.Errorf("failed to delete old commits: %w", err)
+	}
+
+	insert, err := tx.Prepare(`
+		INSERT INTO commits (
+			username,
+			repo_name,
+			sha,
+			contributor_id,
+			author_name,
+			committed_at,
+			added,
+			removed,
+			files_touched,
+			message
+		)
+		SELECT $1, $2, $3, id, $4, $5, $6, $7, $8, $9
+		FROM contributors
+		WHERE identity = $10
+		ON CONFLICT (username, repo_name, sha) DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare commit insert: %w", err)
+	}
+	defer insert.Close()
+
+	for _, commit := range commits {
+		_, err := insert.Exec(
+			username,
+			repoName,
+			commitSHA(commit),
+			commitAuthor(commit),
+			time.Unix(commit.Date, 0).UTC(),
+			commit.Added,
+			commit.Removed,
+			commit.FilesTouchedCount,
+			commitMessage(commit),
+			ContributorIdentity(commit.Author, commit.AuthorEmail),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert commit %s: %w", commitSHA(commit), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit commits: %w", err)
+	}
+
+	log.Printf("Saved %d commits for %s/%s to database (took %v)", len(commits), username, repoName, time.Since(start))
+	return nil
+}
+
+// SearchRepos matches like the Postgres store without pg_trgm, the names are
+// loaded and compared in Go, which is fine for the size of a local database
+func (s *sqliteStore) SearchRepos(query string, limit int) ([]RepoMatch, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	rows, err := s.db.Query(`
+		SELECT username, repo_name, COALESCE(language, ''), COALESCE(total_stars, 0), total_lines
+		FROM repos
+		WHERE hidden = FALSE
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search repos: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []RepoMatch{}
+	for rows.Next() {
+		var match RepoMatch
+		if err := rows.Scan(&match.Username, &match.RepoName, &match.Language, &match.TotalStars, &match.TotalLines); err != nil {
+			return nil, fmt.Errorf("failed to scan repo match: %w", err)
+		}
+
+		match.Score = nameSimilarity(query, match.Username, match.RepoName)
+		switch kind := matchKind(query, match.Username, match.RepoName); {
+		case kind == matchExact:
+			match.Score = 1
+		case kind == matchPrefix, match.Score >= similarityThreshold, strings.ToLower(match.Language) == query:
+		default:
+			continue
+		}
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return rankMatches(query, matches, limit), nil
+}
+
+// SearchCommits searches the commit messages of a repo with the FTS5 index,
+// every word of q.Query has to match. bm25 ranks lower for better matches.
+func (s *sqliteStore) SearchCommits(username, repoName string, q CommitSearchQuery) ([]CommitMatch, error) {
+	if err := normalizeCommitSearch(&q); err != nil {
+		return nil, err
+	}
+
+	match := ftsQuery(q.Query)
+	if match == "" {
+		return []CommitMatch{}, nil
+	}
+
+	args := []interface{}{username, repoName, match}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := append([]string{
+		"commits_fts MATCH $3",
+		"c.username = $1",
+		"c.repo_name = $2",
+	}, commitSearchFilters(q, arg)...)
+
+	query := fmt.Sprintf(`
+		SELECT c.sha, c.author_name, c.committed_at, c.added, c.removed, c.files_touched, c.message,
+			-bm25(commits_fts) AS score
+		FROM commits_fts
+		JOIN commits c ON c.id = commits_fts.rowid
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, strings.Join(conditions, " AND "), commitSearchOrder(q, "score DESC"),
+		arg(q.Limit), arg(q.Offset))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search commits: %w", err)
+	}
+	return scanCommitMatches(rows)
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// StarPoint is one point on the cumulative star curve of a repository
+type StarPoint struct {
+	Date  int64 `json:"date"`
+	Stars int   `json:"stars"`
+}
+
+// SaveStarHistory stores star points and how many stargazers were paged
+// through to get them, points that are already known are skipped
+func (s *sqlStore) SaveStarHistory(username, repoName string, points []StarPoint, paged int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO star_history (username, repo_name, starred_at, stars)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username, repo_name, stars) DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare star history insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, point := range points {
+		if _, err := stmt.Exec(username, repoName, time.Unix(point.Date, 0).UTC(), point.Stars); err != nil {
+			return fmt.Errorf("failed to insert star point: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE repos
+		SET stargazers_paged = $3
+		WHERE username = $1 AND repo_name = $2
+	`, username, repoName, paged)
+	if err != nil {
+		return fmt.Errorf("failed to update stargazers paged: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit star history: %w", err)
+	}
+
+	return nil
+}
+
+// GetStarHistory returns the stored star curve, oldest first
+func (s *sqlStore) GetStarHistory(username, repoName string) ([]StarPoint, error) {
+	query := `
+		SELECT starred_at, stars
+		FROM star_history
+		WHERE username = $1 AND repo_name = $2
+		ORDER BY stars ASC
+	`
+
+	rows, err := s.db.Query(query, username, repoName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query star history: %w", err)
+	}
+	defer rows.Close()
+
+	points := []StarPoint{}
+	for rows.Next() {
+		var starredAt time.Time
+		var point StarPoint
+		if err := rows.Scan(&starredAt, &point.Stars); err != nil {
+			return nil, fmt.Errorf("failed to scan star point: %w", err)
+		}
+		point.Date = starredAt.Unix()
+		points = append(points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return points, nil
+}
+
+// GetStargazersPaged returns how many stargazers were already paged through,
+// so a refresh only has to page through stargazers added since then. Repos
+// refreshed before that was recorded fall back to their highest star point.
+func (s *sqlStore) GetStargazersPaged(username, repoName string) (int, error) {
+	var stars int
+	err := s.db.QueryRow(`
+		SELECT COALESCE(MAX(stars), 0)
+		FROM (
+			SELECT MAX(stars) AS stars
+			FROM star_history
+			WHERE username = $1 AND repo_name = $2
+			UNION ALL
+			SELECT stargazers_paged
+			FROM repos
+			WHERE username = $1 AND repo_name = $2
+		) paged
+	`, username, repoName).Scan(&stars)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stargazers paged: %w", err)
+	}
+
+	return stars, nil
+}
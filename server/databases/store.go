@@ -0,0 +1,272 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errNotInitialized = errors.New("database not initialized")
+
+// RepoStore is implemented by every database backend. The package level
+// functions delegate to the store picked by Init, so callers never have to
+// know which backend is in use.
+type RepoStore interface {
+	SaveRepo(data RepoData) error
+	IncrementViews(username, repoName string) error
+	GetRepo(username, repoName string) (*RepoData, error)
+	GetTopRepos(query TopReposQuery) ([]RepoData, string, error)
+	SearchRepos(query string, limit int) ([]RepoMatch, error)
+	SetRepoFeatured(username, repoName string, featured bool) error
+	SetRepoHidden(username, repoName string, hidden bool) error
+	UpdateLastCachedAt(username, repoName string, ttl time.Duration) error
+	BackfillHistograms() (int, error)
+
+	SaveStarHistory(username, repoName string, points []StarPoint, paged int) error
+	GetStarHistory(username, repoName string) ([]StarPoint, error)
+	GetStargazersPaged(username, repoName string) (int, error)
+
+	SaveAnalysisRun(username, repoName string, run AnalysisRun) error
+	GetAnalysisRuns(username, repoName string, limit int) ([]AnalysisRun, error)
+
+	SaveCommits(username, repoName string, commits []CommitStats) error
+	SearchCommits(username, repoName string, query CommitSearchQuery) ([]CommitMatch, error)
+
+	RecordView(username, repoName, clientHash string, at time.Time) error
+	GetTrendingRepos(window time.Duration, limit int) ([]TrendingRepo, error)
+	RollupViews(before, retainAfter time.Time) (int, error)
+
+	Migrate() error
+	Rollback(steps int) error
+	MigrationStatus() (*MigrationStatus, error)
+
+	Close() error
+}
+
+var store RepoStore
+
+// OpenStore connects to the backend named by the DSN scheme. sqlite:// and
+// sqlite: DSNs open an embedded SQLite file, anything else goes to Postgres.
+func OpenStore(dsn string) (RepoStore, error) {
+	switch {
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return newSQLiteStore(strings.TrimPrefix(dsn, "sqlite://"))
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return newSQLiteStore(strings.TrimPrefix(dsn, "sqlite:"))
+	default:
+		return newPostgresStore(dsn)
+	}
+}
+
+// Init connects to the database and brings its schema up to date
+func Init(dsn string) error {
+	if err := Open(dsn); err != nil {
+		return err
+	}
+
+	if err := store.Migrate(); err != nil {
+		// Don't leave a connection around for a schema we failed to bring up
+		Close()
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return nil
+}
+
+// Open connects to the database without touching its schema
+func Open(dsn string) error {
+	s, err := OpenStore(dsn)
+	if err != nil {
+		return err
+	}
+
+	store = s
+	return nil
+}
+
+func Close() error {
+	if store == nil {
+		return nil
+	}
+	stopViewRollup()
+
+	err := store.Close()
+	store = nil
+	return err
+}
+
+// sqlStore holds the queries that are portable between Postgres and SQLite.
+// Backends embed it and add what differs, like bulk loading and locking.
+type sqlStore struct {
+	db *sql.DB
+
+	// migrationsDir is the embedded directory holding the backend's migrations
+	migrationsDir string
+	// lockMigrations serializes migrations across instances sharing a database
+	lockMigrations func(conn *sql.Conn) (unlock func(), err error)
+	// unixTime converts a TIMESTAMP column to unix seconds in SQL
+	unixTime func(column string) string
+	// lockTx serializes transactions holding the same key across instances
+	// until tx ends
+	lockTx func(tx *sql.Tx, key int64) error
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func SaveRepo(data RepoData) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SaveRepo(data)
+}
+
+func IncrementViews(username, repoName string) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.IncrementViews(username, repoName)
+}
+
+func GetRepo(username, repoName string) (*RepoData, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetRepo(username, repoName)
+}
+
+func GetTopRepos(query TopReposQuery) ([]RepoData, string, error) {
+	if store == nil {
+		return nil, "", errNotInitialized
+	}
+	return store.GetTopRepos(query)
+}
+
+func SearchRepos(query string, limit int) ([]RepoMatch, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.SearchRepos(query, limit)
+}
+
+func SetRepoFeatured(username, repoName string, featured bool) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SetRepoFeatured(username, repoName, featured)
+}
+
+func SetRepoHidden(username, repoName string, hidden bool) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SetRepoHidden(username, repoName, hidden)
+}
+
+func UpdateLastCachedAt(username, repoName string, ttl time.Duration) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.UpdateLastCachedAt(username, repoName, ttl)
+}
+
+func BackfillHistograms() (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.BackfillHistograms()
+}
+
+func SaveStarHistory(username, repoName string, points []StarPoint, paged int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SaveStarHistory(username, repoName, points, paged)
+}
+
+func GetStarHistory(username, repoName string) ([]StarPoint, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetStarHistory(username, repoName)
+}
+
+func GetStargazersPaged(username, repoName string) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.GetStargazersPaged(username, repoName)
+}
+
+func SaveAnalysisRun(username, repoName string, run AnalysisRun) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SaveAnalysisRun(username, repoName, run)
+}
+
+func GetAnalysisRuns(username, repoName string, limit int) ([]AnalysisRun, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetAnalysisRuns(username, repoName, limit)
+}
+
+func SaveCommits(username, repoName string, commits []CommitStats) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.SaveCommits(username, repoName, commits)
+}
+
+func SearchCommits(username, repoName string, query CommitSearchQuery) ([]CommitMatch, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.SearchCommits(username, repoName, query)
+}
+
+func RecordView(username, repoName, clientHash string, at time.Time) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.RecordView(username, repoName, clientHash, at)
+}
+
+func GetTrendingRepos(window time.Duration, limit int) ([]TrendingRepo, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.GetTrendingRepos(window, limit)
+}
+
+func RollupViews(before, retainAfter time.Time) (int, error) {
+	if store == nil {
+		return 0, errNotInitialized
+	}
+	return store.RollupViews(before, retainAfter)
+}
+
+func Migrate() error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.Migrate()
+}
+
+func Rollback(steps int) error {
+	if store == nil {
+		return errNotInitialized
+	}
+	return store.Rollback(steps)
+}
+
+func GetMigrationStatus() (*MigrationStatus, error) {
+	if store == nil {
+		return nil, errNotInitialized
+	}
+	return store.MigrationStatus()
+}
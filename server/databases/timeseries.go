@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxTimeseriesBuckets caps a series, commits before its first bucket are
+// counted in it. Over 13 years of days.
+const maxTimeseriesBuckets = 5000
+
+// Interval is the width of a timeseries bucket, buckets start at midnight
+// UTC, on Mondays for weeks and on the first for months
+type Interval string
+
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+)
+
+// ParseInterval checks an interval name
+func ParseInterval(name string) (Interval, error) {
+	switch interval := Interval(name); interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+		return interval, nil
+	}
+	return "", fmt.Errorf("unknown interval %q, expected day, week or month", name)
+}
+
+// Start returns the start of the bucket t falls in
+func (i Interval) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case IntervalWeek:
+		// Weekday counts from Sunday, weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at start
+func (i Interval) Next(start time.Time) time.Time {
+	switch i {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Timeseries holds commit metrics per bucket as parallel arrays, index i of
+// every array belongs to the bucket starting at Dates[i]. Buckets without
+// commits are included so the arrays have no gaps.
+type Timeseries struct {
+	Interval Interval `json:"interval"`
+	// Unix seconds of the bucket starts
+	Dates   []int64 `json:"dates"`
+	Commits []int   `json:"commits"`
+	Added   []int   `json:"added"`
+	Removed []int   `json:"removed"`
+	// Distinct authors that committed in the bucket
+	Authors []int `json:"authors"`
+	// Lines of code at the end of the bucket
+	LOC []int `json:"loc"`
+}
+
+// CalculateTimeseries buckets commits by interval, see chartDate for the
+// dates it uses
+func CalculateTimeseries(commits []CommitStats, interval Interval) *Timeseries {
+	series := &Timeseries{
+		Interval: interval,
+		Dates:    []int64{},
+		Commits:  []int{},
+		Added:    []int{},
+		Removed:  []int{},
+		Authors:  []int{},
+		LOC:      []int{},
+	}
+	if len(commits) == 0 {
+		return series
+	}
+
+	now := time.Now().Unix()
+	first, last := chartDate(commits[0], now), chartDate(commits[0], now)
+	for _, commit := range commits {
+		first = min(first, chartDate(commit, now))
+		last = max(last, chartDate(commit, now))
+	}
+
+	end := time.Unix(last, 0)
+	for start := interval.Start(time.Unix(first, 0)); !start.After(end); start = interval.Next(start) {
+		series.Dates = append(series.Dates, start.Unix())
+	}
+	if len(series.Dates) > maxTimeseriesBuckets {
+		series.Dates = series.Dates[len(series.Dates)-maxTimeseriesBuckets:]
+	}
+	index := make(map[int64]int, len(series.Dates))
+	for i, date := range series.Dates {
+		index[date] = i
+	}
+
+	buckets := len(series.Dates)
+	series.Commits = make([]int, buckets)
+	series.Added = make([]int, buckets)
+	series.Removed = make([]int, buckets)
+	series.Authors = make([]int, buckets)
+	series.LOC = make([]int, buckets)
+
+	authors := make([]map[string]bool, buckets)
+	for _, commit := range commits {
+		// Missing from the index when before the first bucket
+		i := index[interval.Start(time.Unix(chartDate(commit, now), 0)).Unix()]
+		series.Commits[i]++
+		series.Added[i] += commit.Added
+		series.Removed[i] += commit.Removed
+		if authors[i] == nil {
+			authors[i] = make(map[string]bool)
+		}
+		authors[i][commit.Author] = true
+	}
+
+	loc := 0
+	for i := range series.Dates {
+		series.Authors[i] = len(authors[i])
+		loc += series.Added[i] - series.Removed[i]
+		series.LOC[i] = loc
+	}
+
+	return series
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultTopRepos = 100
+	MaxTopRepos     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// QueryError is returned for top repos queries with invalid parameters
+type QueryError struct{ Message string }
+
+func (e *QueryError) Error() string { return e.Message }
+
+// Sort keys of the top repos, all of them sort descending
+const (
+	SortLines   = "lines"
+	SortStars   = "stars"
+	SortViews   = "views"
+	SortCommits = "commits"
+	// Most recently analyzed first
+	SortRecent = "recent"
+)
+
+// TopReposQuery filters and pages the top repos, zero values don't filter
+type TopReposQuery struct {
+	Sort     string
+	Language string
+	Owner    string
+	Featured bool
+
+	MinLines, MaxLines     int
+	MinStars, MaxStars     int
+	MinViews, MaxViews     int
+	MinCommits, MaxCommits int
+
+	Limit int
+	// Cursor is the next cursor returned for the previous page
+	Cursor string
+}
+
+// normalize checks q and fills in the default sort and limit
+func (q *TopReposQuery) normalize() error {
+	switch q.Sort {
+	case "":
+		q.Sort = SortLines
+	case SortLines, SortStars, SortViews, SortCommits, SortRecent:
+	default:
+		return &QueryError{fmt.Sprintf("unknown sort %q, expected lines, stars, views, commits or recent", q.Sort)}
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultTopRepos
+	}
+	if q.Limit < 0 || q.Limit > MaxTopRepos {
+		return &QueryError{fmt.Sprintf("limit must be between 1 and %d", MaxTopRepos)}
+	}
+	return nil
+}
+
+// sortColumn is the SQL expression a sort key orders by
+func (s *sqlStore) sortColumn(sort string) string {
+	switch sort {
+	case SortStars:
+		return "COALESCE(total_stars, 0)"
+	case SortViews:
+		return "views"
+	case SortCommits:
+		return "COALESCE(total_commits, 0)"
+	case SortRecent:
+		return s.unixTime("updated_at")
+	}
+	return "total_lines"
+}
+
+// GetTopRepos returns a page of the repos that aren't hidden, together with
+// the cursor of the next page, empty on the last one. Pages are keyed on the
+// sort value and the row id, so rows moving between requests don't shift
+// later pages.
+func (s *sqlStore) GetTopRepos(q TopReposQuery) ([]RepoData, string, error) {
+	if err := q.normalize(); err != nil {
+		return nil, "", err
+	}
+
+	sortColumn := s.sortColumn(q.Sort)
+	conditions := []string{"hidden = FALSE", "total_lines > 0", "total_commits > 1"}
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Language != "" {
+		conditions = append(conditions, "LOWER(language) = LOWER("+arg(q.Language)+")")
+	}
+	if q.Owner != "" {
+		conditions = append(conditions, "LOWER(username) = LOWER("+arg(q.Owner)+")")
+	}
+	if q.Featured {
+		conditions = append(conditions, "featured = TRUE")
+	}
+
+	for _, bound := range []struct {
+		column   string
+		min, max int
+	}{
+		{"total_lines", q.MinLines, q.MaxLines},
+		{"COALESCE(total_stars, 0)", q.MinStars, q.MaxStars},
+		{"views", q.MinViews, q.MaxViews},
+		{"COALESCE(total_commits, 0)", q.MinCommits, q.MaxCommits},
+	} {
+		if bound.min > 0 {
+			conditions = append(conditions, bound.column+" >= "+arg(bound.min))
+		}
+		if bound.max > 0 {
+			conditions = append(conditions, bound.column+" <= "+arg(bound.max))
+		}
+	}
+
+	if q.Cursor != "" {
+		value, id, err := decodeRepoCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		v, i := arg(value), arg(id)
+		conditions = append(conditions, fmt.Sprintf("(%s < %s OR (%s = %s AND id < %s))", sortColumn, v, sortColumn, v, i))
+	}
+
+	// One extra row tells whether there is another page
+	query := fmt.Sprintf(`
+		SELECT id, %s, username, repo_name, total_additions, total_lines, total_removals, views, lines_histogram,
+			COALESCE(total_stars, 0), COALESCE(total_commits, 0), COALESCE(language, ''), last_cached_at, cache_ttl_seconds, featured
+		FROM repos
+		WHERE %s
+		ORDER BY %s DESC, id DESC
+		LIMIT %s
+	`, sortColumn, strings.Join(conditions, " AND "), sortColumn, arg(q.Limit+1))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query top repos: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []RepoData
+	var lastValue, lastID int64
+	var next string
+	for rows.Next() {
+		if len(repos) == q.Limit {
+			next = encodeRepoCursor(lastValue, lastID)
+			break
+		}
+
+		var data RepoData
+		var histogramJSON string
+
+		err := rows.Scan(
+			&lastID,
+			&lastValue,
+			&data.Username,
+			&data.RepoName,
+			&data.TotalAdditions,
+			&data.TotalLines,
+			&data.TotalRemovals,
+			&data.Views,
+			&histogramJSON,
+			&data.TotalStars,
+			&data.TotalCommits,
+			&data.Language,
+			&data.LastCachedAt,
+			&data.CacheTTLSeconds,
+			&data.Featured,
+		)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan repo row: %w", err)
+		}
+
+		// Parse histogram JSON
+		if err := json.Unmarshal([]byte(histogramJSON), &data.LinesHistogram); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal histogram: %w", err)
+		}
+
+		repos = append(repos, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return repos, next, nil
+}
+
+// SetRepoFeatured marks a repo as featured, ?featured=true lists only those
+func (s *sqlStore) SetRepoFeatured(username, repoName string, featured bool) error {
+	return s.setRepoFlag("featured", username, repoName, featured)
+}
+
+// SetRepoHidden keeps a repo out of the top repos
+func (s *sqlStore) SetRepoHidden(username, repoName string, hidden bool) error {
+	return s.setRepoFlag("hidden", username, repoName, hidden)
+}
+
+// setRepoFlag sets a boolean column of a repo, column is never user input
+func (s *sqlStore) setRepoFlag(column, username, repoName string, value bool) error {
+	query := `UPDATE repos SET ` + column + ` = $3 WHERE username = $1 AND repo_name = $2`
+
+	result, err := s.db.Exec(query, username, repoName, value)
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", column, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("repo %s/%s not found", username, repoName)
+	}
+	return nil
+}
+
+func encodeRepoCursor(value, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", value, id)))
+}
+
+func decodeRepoCursor(cursor string) (int64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	valuePart, idPart, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, 0, ErrInvalidCursor
+	}
+	value, err := strconv.ParseInt(valuePart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return value, id, nil
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	defaultRollupInterval = time.Hour
+	// Hourly views are kept for twice the longest trending window, so that
+	// window can be compared with the one before it
+	viewRetention = 60 * 24 * time.Hour
+	// Key of the lock that keeps instances from rolling up the same events
+	rollupLockID = 4839201458
+)
+
+// TrendingRepo is a repo ranked by its views in a recent window
+type TrendingRepo struct {
+	RepoData
+	RecentViews   int `json:"recentViews"`
+	PreviousViews int `json:"previousViews"`
+	// Change of the views against the window before, 1 is twice as many
+	Velocity float64 `json:"velocity"`
+}
+
+var rollupStop chan struct{}
+
+// RecordView records that a client viewed a repo. Views are counted once
+// per client and hour, clientHash must not identify the client by itself.
+func (s *sqlStore) RecordView(username, repoName, clientHash string, at time.Time) error {
+	query := `
+		INSERT INTO repo_view_events (username, repo_name, hour, client_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username, repo_name, hour, client_hash) DO NOTHING
+	`
+
+	if _, err := s.db.Exec(query, username, repoName, at.UTC().Truncate(time.Hour), clientHash); err != nil {
+		return fmt.Errorf("failed to record view: %w", err)
+	}
+	return nil
+}
+
+// GetTrendingRepos ranks the repos that aren't hidden by their views in the
+// last window, gaining repos rank above ones with as many steady views
+func (s *sqlStore) GetTrendingRepos(window time.Duration, limit int) ([]TrendingRepo, error) {
+	now := time.Now().UTC()
+	since := now.Add(-window).Truncate(time.Hour)
+	previousSince := since.Add(-window)
+
+	// Events of the current hour are not rolled up yet
+	query := `
+		SELECT r.username, r.repo_name, r.total_lines, r.views, r.lines_histogram,
+			COALESCE(r.total_stars, 0), COALESCE(r.total_commits, 0), COALESCE(r.language, ''), r.featured,
+			SUM(v.recent), SUM(v.previous)
+		FROM (
+			SELECT username, repo_name,
+				CASE WHEN hour >= $2 THEN views ELSE 0 END AS recent,
+				CASE WHEN hour < $2 THEN views ELSE 0 END AS previous
+			FROM repo_views_hourly
+			WHERE hour >= $1
+			UNION ALL
+			SELECT username, repo_name,
+				CASE WHEN hour >= $2 THEN 1 ELSE 0 END AS recent,
+				CASE WHEN hour < $2 THEN 1 ELSE 0 END AS previous
+			FROM repo_view_events
+			WHERE hour >= $1
+		) v
+		JOIN repos r ON r.username = v.username AND r.repo_name = v.repo_name
+		WHERE r.hidden = FALSE
+		GROUP BY r.username, r.repo_name, r.total_lines, r.views, r.lines_histogram,
+			r.total_stars, r.total_commits, r.language, r.featured
+		HAVING SUM(v.recent) > 0
+		ORDER BY 2 * SUM(v.recent) - SUM(v.previous) DESC, SUM(v.recent) DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.Query(query, previousSince, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trending repos: %w", err)
+	}
+	defer rows.Close()
+
+	repos := []TrendingRepo{}
+	for rows.Next() {
+		var repo TrendingRepo
+		var histogramJSON string
+
+		err := rows.Scan(
+			&repo.Username,
+			&repo.RepoName,
+			&repo.TotalLines,
+			&repo.Views,
+			&histogramJSON,
+			&repo.TotalStars,
+			&repo.TotalCommits,
+			&repo.Language,
+			&repo.Featured,
+			&repo.RecentViews,
+			&repo.PreviousViews,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trending repo: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(histogramJSON), &repo.LinesHistogram); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal histogram: %w", err)
+		}
+
+		previous := math.Max(float64(repo.PreviousViews), 1)
+		repo.Velocity = math.Round((float64(repo.RecentViews)-float64(repo.PreviousViews))/previous*100) / 100
+
+		repos = append(repos, repo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return repos, nil
+}
+
+// RollupViews moves the view events of the hours before `before` into
+// hourly counts and deletes hourly counts from before retainAfter. It
+// returns how many events were rolled up.
+func (s *sqlStore) RollupViews(before, retainAfter time.Time) (int, error) {
+	before, retainAfter = before.UTC().Truncate(time.Hour), retainAfter.UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Every instance runs the rollup, without the lock two of them could
+	// both count the same events before either deletes them
+	if err := s.lockTx(tx, rollupLockID); err != nil {
+		return 0, fmt.Errorf("failed to lock view rollup: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO repo_views_hourly (username, repo_name, hour, views)
+		SELECT username, repo_name, hour, COUNT(*)
+		FROM repo_view_events
+		WHERE hour < $1
+		GROUP BY username, repo_name, hour
+		ON CONFLICT (username, repo_name, hour)
+		DO UPDATE SET views = repo_views_hourly.views + EXCLUDED.views
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll up views: %w", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM repo_view_events WHERE hour < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete rolled up views: %w", err)
+	}
+	events, _ := result.RowsAffected()
+
+	if _, err := tx.Exec(`DELETE FROM repo_views_hourly WHERE hour < $1`, retainAfter); err != nil {
+		return 0, fmt.Errorf("failed to delete old views: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit view rollup: %w", err)
+	}
+
+	return int(events), nil
+}
+
+// StartViewRollup rolls up view events every VIEW_ROLLUP_INTERVAL (default
+// 1h), VIEW_ROLLUP_INTERVAL=0 turns it off
+func StartViewRollup() {
+	if store == nil || rollupStop != nil {
+		return
+	}
+
+	interval := defaultRollupInterval
+	if value := os.Getenv("VIEW_ROLLUP_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("[DB] Invalid VIEW_ROLLUP_INTERVAL %q, using %v", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		log.Printf("[DB] View rollup disabled")
+		return
+	}
+
+	stop := make(chan struct{})
+	rollupStop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				events, err := RollupViews(now, now.Add(-viewRetention))
+				if err != nil {
+					log.Printf("[DB] View rollup failed: %v", err)
+					continue
+				}
+				log.Printf("[DB] Rolled up %d view events", events)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("[DB] View rollup started, running every %v", interval)
+}
+
+func stopViewRollup() {
+	if rollupStop != nil {
+		close(rollupStop)
+		rollupStop = nil
+	}
+}
@@ -14,6 +14,10 @@ import (
 	database "github.com/immatheus/gitback/databases"
 )
 
+// AnalyzerVersion identifies what AnalyzeCommits produces, bump it whenever
+// the commits or their stats change so cached analyses are recomputed
+const AnalyzerVersion = 4
+
 // GitConfig holds configuration for git operations
 type GitConfig struct {
 	MaxMemoryMB    int
@@ -22,16 +26,26 @@ type GitConfig struct {
 	TempDirPattern string
 }
 
+// CloneOptions controls what is fetched besides the default branch
+type CloneOptions struct {
+	// FetchTags fetches the tags pointing into the cloned history, needed
+	// for the release timeline
+	FetchTags bool
+	// Ref is the branch or tag to clone instead of the default branch
+	Ref string
+}
+
 // Repository represents a cloned git repository
 type Repository struct {
-	Path   string
-	Config GitConfig
-	ctx    context.Context
-	cancel context.CancelFunc
+	Path    string
+	Config  GitConfig
+	Options CloneOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
 }
 
 // CloneRepository safely clones a repository with resource management
-func CloneRepository(repoURL string) (*Repository, error) {
+func CloneRepository(repoURL string, opts CloneOptions) (*Repository, error) {
 	gitConfig := GitConfig{
 		MaxMemoryMB:    500,
 		TimeoutSeconds: 300, // 5 minutes
@@ -48,20 +62,28 @@ func CloneRepository(repoURL string) (*Repository, error) {
 	}
 
 	repo := &Repository{
-		Path:   tmpDir,
-		Config: gitConfig,
-		ctx:    ctx,
-		cancel: cancel,
+		Path:    tmpDir,
+		Config:  gitConfig,
+		Options: opts,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 
 	// Set up command with context and resource limits
-	cmd := exec.CommandContext(ctx, "git", "clone",
+	args := []string{"clone",
 		"--bare",
 		"--single-branch",
 		"--depth=1000", // Limit initial depth for performance
-		"--no-tags",    // Skip tags for faster clone
-		repoURL,
-		tmpDir)
+	}
+	if !opts.FetchTags {
+		args = append(args, "--no-tags") // Skip tags for faster clone
+	}
+	if opts.Ref != "" {
+		args = append(args, "--branch", opts.Ref)
+	}
+	args = append(args, repoURL, tmpDir)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
 
 	// Limit memory usage
 	cmd.Env = append(os.Environ(),
@@ -90,7 +112,13 @@ func (r *Repository) AnalyzeCommits() ([]database.CommitStats, error) {
 		"--git-dir", r.Path,
 		"log",
 		"--numstat",
-		"--format=%H|%an|%at|%s",
+		// %aN and %aE apply .mailmap so contributor names and emails resolve
+		// together. A record
+		// separator starts every commit and a unit separator ends its body,
+		// bodies can contain anything a numstat line can.
+		"--format=%x1e%H|%aN|%aE|%at|%ad|%s%n%b%x1f",
+		// %ad is only the author's UTC offset, like +0200
+		"--date=format:%z",
 		"--reverse", // Process oldest first for better memory usage
 		fmt.Sprintf("--max-count=%d", r.Config.MaxCommits),
 	)
@@ -112,6 +140,8 @@ func (r *Repository) AnalyzeCommits() ([]database.CommitStats, error) {
 	scanner.Buffer(buf, 10*1024*1024) // 10MB max
 
 	var currentCommit *database.CommitStats
+	var body []string
+	inBody := false
 
 	for scanner.Scan() {
 		select {
@@ -121,36 +151,55 @@ func (r *Repository) AnalyzeCommits() ([]database.CommitStats, error) {
 		}
 
 		line := scanner.Text()
+
+		if inBody {
+			text, end := strings.CutSuffix(line, "\x1f")
+			body = append(body, text)
+			if end {
+				inBody = false
+				currentCommit.FullMessage = fullMessage(currentCommit.FullMessage, body)
+			}
+			continue
+		}
+
 		if line == "" {
 			continue
 		}
 
-		if strings.Contains(line, "|") {
+		if header, ok := strings.CutPrefix(line, "\x1e"); ok {
 			// Save previous commit if exists
 			if currentCommit != nil {
 				commits = append(commits, *currentCommit)
 			}
+			currentCommit = nil
 
-			parts := strings.SplitN(line, "|", 4)
-			if len(parts) != 4 {
+			parts := strings.SplitN(header, "|", 6)
+			if len(parts) != 6 {
 				continue
 			}
 
-			timestamp, _ := strconv.ParseInt(parts[2], 10, 64)
+			timestamp, _ := strconv.ParseInt(parts[3], 10, 64)
 			currentCommit = &database.CommitStats{
 				Hash:              parts[0][:min(7, len(parts[0]))],
 				Author:            parts[1],
 				Date:              timestamp,
-				Message:           truncateMessage(parts[3], 100),
+				Message:           truncateMessage(parts[5], 100),
 				Added:             0,
 				Removed:           0,
 				FilesTouchedCount: 0,
+				FullHash:          parts[0],
+				AuthorEmail:       parts[2],
+				FullMessage:       parts[5],
+				UTCOffset:         parseUTCOffset(parts[4]),
 			}
+			body = body[:0]
+			inBody = true
 		} else if currentCommit != nil && strings.Contains(line, "\t") {
 			// Parse numstat line
 			fields := strings.SplitN(line, "\t", 3)
 			if len(fields) >= 3 {
 				currentCommit.FilesTouchedCount++
+				currentCommit.Dirs = addDir(currentCommit.Dirs, fields[2])
 
 				if added, err := strconv.Atoi(fields[0]); err == nil {
 					currentCommit.Added += added
@@ -178,6 +227,22 @@ func (r *Repository) AnalyzeCommits() ([]database.CommitStats, error) {
 	return commits, nil
 }
 
+// HeadSHA returns the full SHA of the commit the clone points at
+func (r *Repository) HeadSHA() (string, error) {
+	cmd := exec.CommandContext(r.ctx, "git",
+		"--git-dir", r.Path,
+		"rev-parse",
+		"HEAD",
+	)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse failed: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
 // Cleanup removes temporary files and cancels context
 func (r *Repository) Cleanup() {
 	if r.cancel != nil {
@@ -202,6 +267,71 @@ func ValidateRepoURL(repoURL string) error {
 	return nil
 }
 
+// Directories recorded per commit, large merges touch hundreds
+const maxCommitDirs = 10
+
+// addDir adds the top level directory of a numstat path to dirs. Renames
+// show up as "old => new" or "dir/{old => new}/file", the new path counts.
+func addDir(dirs []string, path string) []string {
+	if start, end := strings.Index(path, "{"), strings.Index(path, "}"); start >= 0 && end > start {
+		if _, renamed, ok := strings.Cut(path[start+1:end], " => "); ok {
+			path = path[:start] + renamed + path[end+1:]
+		}
+	} else if _, renamed, ok := strings.Cut(path, " => "); ok {
+		path = renamed
+	}
+
+	dir, _, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || dir == "" || len(dirs) >= maxCommitDirs {
+		return dirs
+	}
+	for _, d := range dirs {
+		if d == dir {
+			return dirs
+		}
+	}
+	return append(dirs, dir)
+}
+
+// parseUTCOffset reads a git timezone like +0200 or -0930 as seconds east
+// of UTC, 0 when it can't be read
+func parseUTCOffset(zone string) int {
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return 0
+	}
+	hours, err := strconv.Atoi(zone[1:3])
+	if err != nil {
+		return 0
+	}
+	minutes, err := strconv.Atoi(zone[3:5])
+	if err != nil {
+		return 0
+	}
+
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return offset
+}
+
+// Longest stored commit message, changelog sized merge messages would only
+// bloat the search index
+const maxFullMessage = 10000
+
+// fullMessage joins a subject with the lines of its body. Git doesn't check
+// the encoding of messages, Postgres rejects invalid UTF-8 and NUL bytes.
+func fullMessage(subject string, body []string) string {
+	text := strings.TrimSpace(strings.Join(body, "\n"))
+	if text != "" {
+		subject += "\n\n" + text
+	}
+	if len(subject) > maxFullMessage {
+		subject = subject[:maxFullMessage]
+	}
+	return strings.ReplaceAll(strings.ToValidUTF8(subject, ""), "\x00", "")
+}
+
 func truncateMessage(msg string, maxLen int) string {
 	if len(msg) <= maxLen {
 		return msg
@@ -0,0 +1,239 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	database "github.com/immatheus/gitback/databases"
+)
+
+// maxReleases caps how many of the most recent tags get a rev-list each
+const maxReleases = 200
+
+var semverPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Release describes the changes that went into a single tag
+type Release struct {
+	Tag          string   `json:"tag"`
+	Date         int64    `json:"date"`
+	Commits      int      `json:"commits"`
+	Added        int      `json:"added"`
+	Removed      int      `json:"removed"`
+	Contributors []string `json:"contributors"`
+	Bump         string   `json:"bump,omitempty"` // major, minor or patch compared to the previous semver tag
+}
+
+// ReleaseCadence summarizes how often a repository ships
+type ReleaseCadence struct {
+	TotalReleases             int     `json:"totalReleases"`
+	MeanDaysBetweenReleases   float64 `json:"meanDaysBetweenReleases"`
+	MedianDaysBetweenReleases float64 `json:"medianDaysBetweenReleases"`
+	Major                     int     `json:"major"`
+	Minor                     int     `json:"minor"`
+	Patch                     int     `json:"patch"`
+	NonSemver                 int     `json:"nonSemver"`
+}
+
+type ReleaseTimeline struct {
+	Releases []Release      `json:"releases"`
+	Cadence  ReleaseCadence `json:"cadence"`
+	// Error is set when the tags couldn't be read, the empty timeline is
+	// cached so the repo isn't cloned again for it until the next refresh
+	Error string `json:"error,omitempty"`
+}
+
+type tagRef struct {
+	name string
+	date int64
+}
+
+// AnalyzeReleases builds the release timeline from the fetched tags. The
+// commits are the ones returned by AnalyzeCommits and are used to attribute
+// line changes and contributors to each release.
+func (r *Repository) AnalyzeReleases(commits []database.CommitStats) (*ReleaseTimeline, error) {
+	if !r.Options.FetchTags {
+		return nil, fmt.Errorf("repository was cloned without tags")
+	}
+
+	tags, err := r.listTags()
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string]*database.CommitStats, len(commits))
+	for i := range commits {
+		byHash[commits[i].Hash] = &commits[i]
+	}
+
+	start := 0
+	if len(tags) > maxReleases {
+		start = len(tags) - maxReleases
+	}
+
+	releases := make([]Release, 0, len(tags)-start)
+	for i := start; i < len(tags); i++ {
+		revRange := tags[i].name
+		if i > 0 {
+			revRange = tags[i-1].name + ".." + tags[i].name
+		}
+
+		hashes, err := r.revList(revRange)
+		if err != nil {
+			return nil, err
+		}
+
+		release := Release{
+			Tag:          tags[i].name,
+			Date:         tags[i].date,
+			Commits:      len(hashes),
+			Contributors: []string{},
+		}
+
+		seen := make(map[string]bool)
+		for _, hash := range hashes {
+			commit, ok := byHash[hash[:min(7, len(hash))]]
+			if !ok {
+				continue // outside of the analyzed history
+			}
+			release.Added += commit.Added
+			release.Removed += commit.Removed
+			if !seen[commit.Author] {
+				seen[commit.Author] = true
+				release.Contributors = append(release.Contributors, commit.Author)
+			}
+		}
+		sort.Strings(release.Contributors)
+
+		releases = append(releases, release)
+	}
+
+	return &ReleaseTimeline{
+		Releases: releases,
+		Cadence:  classifyReleases(releases),
+	}, nil
+}
+
+func (r *Repository) listTags() ([]tagRef, error) {
+	cmd := exec.CommandContext(r.ctx, "git",
+		"--git-dir", r.Path,
+		"for-each-ref",
+		"--sort=creatordate",
+		"--format=%(refname:short)|%(creatordate:unix)",
+		"refs/tags",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %w, stderr: %s", err, stderr.String())
+	}
+
+	var tags []tagRef
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		date, _ := strconv.ParseInt(parts[1], 10, 64)
+		tags = append(tags, tagRef{name: parts[0], date: date})
+	}
+
+	return tags, scanner.Err()
+}
+
+func (r *Repository) revList(revRange string) ([]string, error) {
+	cmd := exec.CommandContext(r.ctx, "git",
+		"--git-dir", r.Path,
+		"rev-list",
+		revRange,
+		"--",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list %s failed: %w, stderr: %s", revRange, err, stderr.String())
+	}
+
+	return strings.Fields(string(out)), nil
+}
+
+// classifyReleases computes the cadence between releases and the semver
+// bump of every tag compared to the previous semver tag. It fills in the
+// Bump field of the releases.
+func classifyReleases(releases []Release) ReleaseCadence {
+	cadence := ReleaseCadence{TotalReleases: len(releases)}
+
+	var gaps []float64
+	var previous []int
+	for i := range releases {
+		if i > 0 {
+			gaps = append(gaps, float64(releases[i].Date-releases[i-1].Date)/86400)
+		}
+
+		version := parseSemver(releases[i].Tag)
+		if version == nil {
+			cadence.NonSemver++
+			continue
+		}
+
+		if previous != nil {
+			switch {
+			case version[0] != previous[0]:
+				releases[i].Bump = "major"
+				cadence.Major++
+			case version[1] != previous[1]:
+				releases[i].Bump = "minor"
+				cadence.Minor++
+			default:
+				releases[i].Bump = "patch"
+				cadence.Patch++
+			}
+		}
+		previous = version
+	}
+
+	if len(gaps) > 0 {
+		total := 0.0
+		for _, gap := range gaps {
+			total += gap
+		}
+		cadence.MeanDaysBetweenReleases = total / float64(len(gaps))
+
+		sort.Float64s(gaps)
+		mid := len(gaps) / 2
+		if len(gaps)%2 == 0 {
+			cadence.MedianDaysBetweenReleases = (gaps[mid-1] + gaps[mid]) / 2
+		} else {
+			cadence.MedianDaysBetweenReleases = gaps[mid]
+		}
+	}
+
+	return cadence
+}
+
+func parseSemver(tag string) []int {
+	match := semverPattern.FindStringSubmatch(tag)
+	if match == nil {
+		return nil
+	}
+
+	version := make([]int, 3)
+	for i := 0; i < 3; i++ {
+		if match[i+1] != "" {
+			version[i], _ = strconv.Atoi(match[i+1])
+		}
+	}
+	return version
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,72 +12,60 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
 	database "github.com/immatheus/gitback/databases"
 	"github.com/immatheus/gitback/git"
 	"github.com/immatheus/gitback/middleware"
 	"github.com/immatheus/gitback/storage"
+	"golang.org/x/sync/singleflight"
 )
 
-type AnalyzeRequest struct {
-	Username string `json:"username" validate:"required,min=1,max=255"`
-	Repo     string `json:"repo" validate:"required,min=1,max=255"`
+var githubClient = &http.Client{
+	Timeout: 15 * time.Second,
 }
 
-type GitHubRepo struct {
-	StargazersCount int    `json:"stargazers_count"`
-	Language        string `json:"language"`
-	Size            int    `json:"size"`
-}
+var (
+	errRepoNotFound   = errors.New("repository not found")
+	errCloneFailed    = errors.New("failed to clone repository")
+	errAnalysisFailed = errors.New("failed to analyze repository")
+)
 
-type GitHubPullRequest struct {
-	ID          int64                  `json:"id"`
-	Number      int                    `json:"number"`
-	Title       string                 `json:"title"`
-	Body        string                 `json:"body"`
-	User        GitHubUser             `json:"user"`
-	CreatedAt   string                 `json:"created_at"`
-	State       string                 `json:"state"`
-	HTMLURL     string                 `json:"html_url"`
-	Comments    int                    `json:"comments"`
-	PullRequest *GitHubPullRequestInfo `json:"pull_request,omitempty"`
-	Reactions   GitHubReactions        `json:"reactions"`
-}
+// analysisFlights deduplicates analyses of the same repo
+var analysisFlights singleflight.Group
 
-type GitHubPullRequestInfo struct {
-	MergedAt *string `json:"merged_at"`
-}
+const (
+	// How long a repo isn't refreshed in the background after a refresh failed
+	refreshBackoff     = 10 * time.Minute
+	maxRefreshFailures = 1000
+)
 
-type GitHubReactions struct {
-	TotalCount int `json:"total_count"`
-	PlusOne    int `json:"+1"`
-	MinusOne   int `json:"-1"`
-	Laugh      int `json:"laugh"`
-	Hooray     int `json:"hooray"`
-	Confused   int `json:"confused"`
-	Heart      int `json:"heart"`
-	Rocket     int `json:"rocket"`
-	Eyes       int `json:"eyes"`
-}
+var (
+	refreshFailuresMu sync.Mutex
+	refreshFailures   = make(map[string]time.Time)
+)
 
-type GitHubUser struct {
-	Login     string `json:"login"`
-	AvatarURL string `json:"avatar_url"`
-	HTMLURL   string `json:"html_url"`
+// analysisTarget is what gets analyzed, Ref is empty for the default branch
+type analysisTarget struct {
+	Username string
+	Repo     string
+	Ref      string
+	Releases bool
 }
 
-type GitHubSearchResult struct {
-	TotalCount int                 `json:"total_count"`
-	Items      []GitHubPullRequest `json:"items"`
+func (t analysisTarget) repoURL() string {
+	return fmt.Sprintf("https://github.com/%s/%s.git", t.Username, t.Repo)
 }
 
-var githubClient = &http.Client{
-	Timeout: 15 * time.Second,
+func (t analysisTarget) String() string {
+	name := t.Username + "/" + t.Repo
+	if t.Ref != "" {
+		name += "@" + t.Ref
+	}
+	return name
 }
 
 func AnalyzeRepo(c *fiber.Ctx) error {
-	requestStart := time.Now()
-
-	var req AnalyzeRequest
+	var req api.AnalyzeRequest
 	if err := c.BodyParser(&req); err != nil {
 		log.Printf("Error parsing request body: %v", err)
 		return middleware.ValidationError(c, "Invalid request body")
@@ -87,76 +76,302 @@ func AnalyzeRepo(c *fiber.Ctx) error {
 		return middleware.ValidationError(c, err.Error())
 	}
 
-	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", req.Username, req.Repo)
-	log.Printf("=== Starting analysis for: %s ===", repoURL)
+	opts, err := parseResponseOptions(c)
+	if err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	target := analysisTarget{Username: req.Username, Repo: req.Repo, Releases: req.Releases || opts.wants("releases")}
+	return serveAnalysis(c, target, opts)
+}
+
+// GetRepoAnalysis is the cacheable GET counterpart of AnalyzeRepo. ?ref=
+// analyzes a branch or tag instead of the default branch, ?sections= picks
+// the sections to send.
+func GetRepoAnalysis(c *fiber.Ctx) error {
+	owner, repo := c.Params("owner"), c.Params("repo")
+	if err := validateRequest(api.AnalyzeRequest{Username: owner, Repo: repo}); err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	ref := c.Query("ref")
+	if err := validateRef(ref); err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	opts, err := parseResponseOptions(c)
+	if err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	target := analysisTarget{Username: owner, Repo: repo, Ref: ref, Releases: opts.wants("releases")}
+	return serveAnalysis(c, target, opts)
+}
+
+// serveAnalysis sends the cached analysis of target or runs a new one
+func serveAnalysis(c *fiber.Ctx, target analysisTarget, opts responseOptions) error {
+	requestStart := time.Now()
+
+	analysis, err := loadAnalysis(target, target.Ref == "")
+	if err != nil {
+		return analysisError(c, err)
+	}
+
+	if target.Ref == "" {
+		recordView(c, target.Username, target.Repo)
+	}
+
+	log.Printf("[TIMING] Total request time: %v", time.Since(requestStart))
+	return sendAnalysis(c, analysis, opts)
+}
+
+// loadAnalysis returns the cached analysis of target, running one when there
+// is none. Views are only counted for the default branch and when countView
+// is set.
+func loadAnalysis(target analysisTarget, countView bool) (*storage.CachedAnalysis, error) {
+	log.Printf("=== Starting analysis for: %s ===", target)
+	countView = countView && target.Ref == ""
+
+	if cachedData := cachedAnalysis(target, countView); cachedData != nil {
+		return cachedData, nil
+	}
+
+	// Validate repository URL before processing
+	if err := git.ValidateRepoURL(target.repoURL()); err != nil {
+		return nil, &invalidRepoError{err}
+	}
 
-	if cachedData, err := storage.GetFromCache(req.Username, req.Repo); err != nil {
+	return analyze(target, countView)
+}
+
+// cachedAnalysis returns the cached analysis of target, or nil when a new
+// one has to run. Stale analyses are refreshed in the background.
+func cachedAnalysis(target analysisTarget, countView bool) *storage.CachedAnalysis {
+	repoURL := target.repoURL()
+
+	if cachedData, err := storage.GetFromCache(target.Username, target.Repo, target.Ref); err != nil {
 		log.Printf("Cache check failed: %v", err)
+	} else if cachedData != nil && target.Releases && !cachedData.HasSection("releases") {
+		log.Printf("Cached analysis for %s has no release timeline, re-analyzing", target)
 	} else if cachedData != nil {
-		log.Printf("Returning cached analysis for %s", repoURL)
+		if cachedData.Stale {
+			log.Printf("Returning stale analysis for %s, refreshing in background", target)
+			refresh := target
+			refresh.Releases = cachedData.HasSection("releases")
+			refreshAnalysis(refresh)
+		} else {
+			log.Printf("Returning cached analysis for %s", target)
+		}
 
 		// Update view count in background
+		if countView {
+			go func() {
+				if err := database.IncrementViews(target.Username, target.Repo); err != nil {
+					log.Printf("[DB] Failed to increment views for %s: %v", repoURL, err)
+				}
+			}()
+		}
+
+		return cachedData
+	}
+	return nil
+}
+
+// requestedAnalysis loads the analysis of :owner/:repo at ?ref= for the
+// endpoints derived from it. It returns a nil analysis after sending an
+// error response. Views are not counted, the analysis page already did.
+func requestedAnalysis(c *fiber.Ctx) (analysisTarget, *storage.CachedAnalysis, error) {
+	target := analysisTarget{Username: c.Params("owner"), Repo: c.Params("repo"), Ref: c.Query("ref")}
+	if err := validateRequest(api.AnalyzeRequest{Username: target.Username, Repo: target.Repo}); err != nil {
+		return target, nil, middleware.ValidationError(c, err.Error())
+	}
+	if err := validateRef(target.Ref); err != nil {
+		return target, nil, middleware.ValidationError(c, err.Error())
+	}
+
+	analysis, err := loadAnalysis(target, false)
+	if err != nil {
+		return target, nil, analysisError(c, err)
+	}
+	return target, analysis, nil
+}
+
+// invalidRepoError is returned by loadAnalysis for repos that can't be cloned
+type invalidRepoError struct{ err error }
+
+func (e *invalidRepoError) Error() string { return e.err.Error() }
+
+// analysisError sends the response for an error of loadAnalysis
+func analysisError(c *fiber.Ctx, err error) error {
+	switch status, message := analysisFailure(err); status {
+	case fiber.StatusBadRequest:
+		return middleware.ValidationError(c, message)
+	case fiber.StatusNotFound:
+		return middleware.NotFoundError(c, message)
+	default:
+		return middleware.InternalError(c, message)
+	}
+}
+
+// analysisFailure is the status and message of an error of loadAnalysis
+func analysisFailure(err error) (int, string) {
+	var invalid *invalidRepoError
+	switch {
+	case errors.As(err, &invalid):
+		return fiber.StatusBadRequest, err.Error()
+	case errors.Is(err, errRepoNotFound):
+		return fiber.StatusNotFound, "Repository not found"
+	case errors.Is(err, errCloneFailed):
+		return fiber.StatusInternalServerError, "Failed to clone repository"
+	}
+	return fiber.StatusInternalServerError, "Failed to analyze repository"
+}
+
+// analyze runs an analysis, concurrent calls for the same target share one
+// clone. countView is false for background refreshes, the stale hit that
+// started them already counted the view.
+func analyze(target analysisTarget, countView bool) (*storage.CachedAnalysis, error) {
+	result, err, _ := analysisFlights.Do(target.flightKey(), func() (interface{}, error) {
+		analysis, err := runAnalysis(target, countView)
+		return &analysisFlight{analysis: analysis, countsView: countView}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A request that joined a background refresh counts its own view, the
+	// repo was saved by the analysis that went stale
+	flight := result.(*analysisFlight)
+	if countView && !flight.countsView {
 		go func() {
-			if err := database.IncrementViews(req.Username, req.Repo); err != nil {
-				log.Printf("[DB] Failed to increment views for %s: %v", repoURL, err)
+			if err := database.IncrementViews(target.Username, target.Repo); err != nil {
+				log.Printf("[DB] Failed to increment views for %s: %v", target.repoURL(), err)
 			}
 		}()
+	}
+	return flight.analysis, nil
+}
 
-		return c.JSON(cachedData)
+// analysisFlight is the outcome of an analysis shared by the requests that
+// joined it, countsView tells whether the analysis counted a view
+type analysisFlight struct {
+	analysis   *storage.CachedAnalysis
+	countsView bool
+}
+
+// flightKey identifies the analyses that can share a clone
+func (t analysisTarget) flightKey() string {
+	key := strings.ToLower(t.Username+"/"+t.Repo) + "@" + t.Ref
+	if t.Releases {
+		key += "?releases"
 	}
+	return key
+}
 
-	// Validate repository URL before processing
-	if err := git.ValidateRepoURL(repoURL); err != nil {
-		return middleware.ValidationError(c, err.Error())
+// refreshAnalysis re-analyzes a repo in the background after a stale hit.
+// After a failed refresh the stale analysis is served without retrying for
+// refreshBackoff, so every hit doesn't clone a repo that keeps failing.
+func refreshAnalysis(target analysisTarget) {
+	key := target.flightKey()
+	refreshFailuresMu.Lock()
+	failedAt, failed := refreshFailures[key]
+	refreshFailuresMu.Unlock()
+	if failed && time.Since(failedAt) < refreshBackoff {
+		log.Printf("Skipping background refresh of %s, it failed %v ago", target, time.Since(failedAt))
+		return
 	}
 
+	go func() {
+		_, err := analyze(target, false)
+
+		refreshFailuresMu.Lock()
+		defer refreshFailuresMu.Unlock()
+		if err == nil {
+			delete(refreshFailures, key)
+			return
+		}
+		log.Printf("Background refresh of %s failed: %v", target, err)
+		if len(refreshFailures) >= maxRefreshFailures {
+			refreshFailures = make(map[string]time.Time)
+		}
+		refreshFailures[key] = time.Now()
+	}()
+}
+
+// runAnalysis clones and analyzes a repository, saves it to the database
+// and stores the encoded result in the cache. Only the default branch is
+// saved to the database, it is what the repos row and history describe.
+func runAnalysis(target analysisTarget, countView bool) (*storage.CachedAnalysis, error) {
+	start := time.Now()
+	username, repoName := target.Username, target.Repo
+	repoURL := target.repoURL()
+
 	// Clone and analyze repository with improved git operations
-	repo, err := git.CloneRepository(repoURL)
+	repo, err := git.CloneRepository(repoURL, git.CloneOptions{FetchTags: target.Releases, Ref: target.Ref})
 	if err != nil {
 		if isNotFoundError(err) {
 			log.Printf("Repository not found: %s - Error: %v", repoURL, err)
-			return middleware.NotFoundError(c, "Repository not found")
+			return nil, errRepoNotFound
 		}
 		log.Printf("Failed to clone repository: %s - Error: %v", repoURL, err)
-		return middleware.InternalError(c, "Failed to clone repository")
+		return nil, errCloneFailed
 	}
 	defer repo.Cleanup()
 
 	commits, err := repo.AnalyzeCommits()
 	if err != nil {
 		log.Printf("Failed to analyze commits for %s: %v", repoURL, err)
-		return middleware.InternalError(c, "Failed to analyze repository")
+		return nil, errAnalysisFailed
+	}
+
+	headSHA, err := repo.HeadSHA()
+	if err != nil {
+		log.Printf("Failed to resolve HEAD for %s: %v", repoURL, err)
+	}
+
+	var releases *git.ReleaseTimeline
+	if target.Releases {
+		if releases, err = repo.AnalyzeReleases(commits); err != nil {
+			log.Printf("Failed to analyze releases for %s: %v", repoURL, err)
+		}
+	}
+	// Keep the timeline of the previous analysis rather than dropping it
+	if releases == nil {
+		releases = previousReleases(target)
+	}
+	if releases == nil && target.Releases {
+		releases = &git.ReleaseTimeline{Releases: []git.Release{}, Error: "Failed to analyze releases"}
+	}
+
+	result := &api.AnalysisResult{
+		Version:      api.Version,
+		TotalCommits: len(commits),
+		Commits:      commits,
+		Releases:     releases,
 	}
 
 	// Process statistics
-	totalAdded := 0
-	totalRemoved := 0
-	totalContributors := 0
 	contributors := make(map[string]bool)
-
 	for _, commit := range commits {
-		totalAdded += commit.Added
-		totalRemoved += commit.Removed
+		result.TotalAdded += commit.Added
+		result.TotalRemoved += commit.Removed
 		if _, ok := contributors[commit.Author]; !ok {
 			contributors[commit.Author] = true
-			totalContributors++
+			result.TotalContributors++
 		}
 	}
 
 	log.Printf("Analysis completed for %s: %d commits, %d contributors, +%d/-%d lines",
-		repoURL, len(commits), totalContributors, totalAdded, totalRemoved)
+		repoURL, len(commits), result.TotalContributors, result.TotalAdded, result.TotalRemoved)
 
 	// Fetch GitHub data in parallel
-	var githubInfo *GitHubRepo
-	var pullRequests *GitHubSearchResult
-
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
-		if repoInfo, err := fetchGitHubRepoInfo(req.Username, req.Repo); err == nil {
-			githubInfo = repoInfo
+		if repoInfo, err := fetchGitHubRepoInfo(username, repoName); err == nil {
+			result.GitHub = repoInfo
 		} else {
 			log.Printf("Failed to fetch GitHub repo info: %v", err)
 		}
@@ -164,64 +379,151 @@ func AnalyzeRepo(c *fiber.Ctx) error {
 
 	go func() {
 		defer wg.Done()
-		if pullRequestInfo, err := fetchRepoTopPullRequests(req.Username, req.Repo); err == nil {
-			pullRequests = pullRequestInfo
+		if pullRequestInfo, err := fetchRepoTopPullRequests(username, repoName); err == nil {
+			result.PullRequests = pullRequestInfo
 		} else {
 			log.Printf("Failed to fetch top pull requests: %v", err)
 		}
 	}()
 
+	go func() {
+		defer wg.Done()
+		if issueStats, err := fetchRepoIssueStats(username, repoName); err == nil {
+			result.Issues = issueStats
+		} else {
+			log.Printf("Failed to fetch issues: %v", err)
+		}
+	}()
+
 	wg.Wait()
 
+	// Encode once, the same bytes are sent now and served from the cache later
+	encoded, err := storage.EncodeAnalysis(result)
+	if err != nil {
+		log.Printf("Failed to encode analysis for %s: %v", repoURL, err)
+		return nil, errAnalysisFailed
+	}
+
+	encoded.TTL = storage.CacheTTL(repoActivity(commits, result.GitHub))
+	log.Printf("Cache TTL for %s is %v", repoURL, encoded.TTL)
+
+	profiles := api.ContributorProfiles{Total: result.TotalContributors, Contributors: database.CalculateContributors(commits)}
+	if len(profiles.Contributors) > maxContributors {
+		profiles.Contributors = profiles.Contributors[:maxContributors]
+	}
+	if encoded.Contributors, err = json.Marshal(profiles); err != nil {
+		log.Printf("Failed to encode contributors for %s: %v", repoURL, err)
+		return nil, errAnalysisFailed
+	}
+
+	// Stored before the flight ends, so requests right after it find the new
+	// analysis instead of starting another one
+	cacheTTL := encoded.TTL
+	if err := storage.StoreInCache(username, repoName, target.Ref, encoded); err != nil {
+		log.Printf("Failed to store analysis in cache for %s: %v", repoURL, err)
+		cacheTTL = 0
+	} else if err := storage.StoreContributors(username, repoName, target.Ref, encoded, encoded.Contributors); err != nil {
+		log.Printf("Failed to store contributors in cache for %s: %v", repoURL, err)
+	}
+
 	// Save to database in background
-	go func() {
-		histogram := database.CalculateLinesHistogram(commits, 10)
-		totalLines := totalAdded - totalRemoved
-
-		dbData := database.RepoData{
-			Username:       req.Username,
-			RepoName:       req.Repo,
-			TotalAdditions: totalAdded,
-			TotalLines:     totalLines,
-			TotalRemovals:  totalRemoved,
-			LinesHistogram: histogram,
-			TotalStars:     githubInfo.StargazersCount,
-			TotalCommits:   len(commits),
-			Language:       githubInfo.Language,
-			Size:           githubInfo.Size,
+	if target.Ref == "" {
+		go saveAnalysis(username, repoName, result, headSHA, cacheTTL, countView)
+	}
+
+	log.Printf("[TIMING] Analysis of %s took %v", repoURL, time.Since(start))
+	return encoded, nil
+}
+
+// previousReleases returns the release timeline of the cached analysis of
+// target, nil when there is none
+func previousReleases(target analysisTarget) *git.ReleaseTimeline {
+	cached, err := storage.GetFromCache(target.Username, target.Repo, target.Ref)
+	if err != nil || cached == nil || !cached.HasSection("releases") {
+		return nil
+	}
+
+	data, err := cached.Decode()
+	if err != nil {
+		return nil
+	}
+	var previous struct {
+		Releases *git.ReleaseTimeline `json:"releases"`
+	}
+	if err := json.Unmarshal(data, &previous); err != nil {
+		log.Printf("Failed to read previous releases of %s: %v", target, err)
+		return nil
+	}
+	return previous.Releases
+}
+
+// saveAnalysis persists a finished analysis: the repos row, its commits, a
+// history snapshot and the star history. cacheTTL is the TTL the analysis
+// was cached with, 0 when it wasn't cached.
+func saveAnalysis(username, repoName string, result *api.AnalysisResult, headSHA string, cacheTTL time.Duration, countView bool) {
+	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", username, repoName)
+	histogram := database.CalculateLinesHistogram(result.Commits, database.HistogramPoints)
+
+	if err := database.SaveRepo(result.RepoData(username, repoName, histogram)); err != nil {
+		log.Printf("[DB] Failed to save repo to database for %s: %v", repoURL, err)
+	} else if cacheTTL > 0 {
+		// Only after the insert, a new repo has no row to update before it
+		if err := database.UpdateLastCachedAt(username, repoName, cacheTTL); err != nil {
+			log.Printf("[DB] Failed to update last cached timestamp for %s: %v", repoURL, err)
 		}
+	}
+
+	if err := database.SaveCommits(username, repoName, result.Commits); err != nil {
+		log.Printf("[DB] Failed to save commits for %s: %v", repoURL, err)
+	}
+
+	if err := database.SaveAnalysisRun(username, repoName, result.AnalysisRun(headSHA, histogram)); err != nil {
+		log.Printf("[DB] Failed to save analysis run for %s: %v", repoURL, err)
+	}
 
-		if err := database.SaveRepo(dbData); err != nil {
-			log.Printf("[DB] Failed to save repo to database for %s: %v", repoURL, err)
+	if result.GitHub != nil {
+		if err := refreshStarHistory(username, repoName, result.GitHub.StargazersCount); err != nil {
+			log.Printf("[DB] Failed to refresh star history for %s: %v", repoURL, err)
 		}
+	}
 
-		if err := database.IncrementViews(req.Username, req.Repo); err != nil {
+	if countView {
+		if err := database.IncrementViews(username, repoName); err != nil {
 			log.Printf("[DB] Failed to increment views for %s: %v", repoURL, err)
 		}
-	}()
+	}
+}
+
+// repoActivity summarizes the commits and forge metadata of an analysis for
+// picking its cache TTL
+func repoActivity(commits []database.CommitStats, githubInfo *api.GitHubRepo) storage.RepoActivity {
+	var activity storage.RepoActivity
+	recentSince := time.Now().AddDate(0, 0, -30).Unix()
 
-	response := fiber.Map{
-		"totalAdded":        totalAdded,
-		"totalRemoved":      totalRemoved,
-		"totalContributors": totalContributors,
-		"totalCommits":      len(commits),
-		"commits":           commits,
-		"github":            githubInfo,
-		"pullRequests":      pullRequests,
+	var lastCommit int64
+	for _, commit := range commits {
+		if commit.Date > lastCommit {
+			lastCommit = commit.Date
+		}
+		if commit.Date >= recentSince {
+			activity.RecentCommits++
+		}
+	}
+	if lastCommit > 0 {
+		activity.LastCommit = time.Unix(lastCommit, 0)
 	}
 
-	// Store in cache asynchronously
-	go func() {
-		if err := storage.StoreInCache(req.Username, req.Repo, response); err != nil {
-			log.Printf("Failed to store analysis in cache for %s: %v", repoURL, err)
+	if githubInfo != nil {
+		activity.Archived = githubInfo.Archived
+		if pushedAt, err := time.Parse(time.RFC3339, githubInfo.PushedAt); err == nil {
+			activity.LastPush = pushedAt
 		}
-	}()
+	}
 
-	log.Printf("[TIMING] Total request time: %v", time.Since(requestStart))
-	return c.JSON(response)
+	return activity
 }
 
-func validateRequest(req AnalyzeRequest) error {
+func validateRequest(req api.AnalyzeRequest) error {
 	if req.Username == "" {
 		return fmt.Errorf("username is required")
 	}
@@ -237,6 +539,19 @@ func validateRequest(req AnalyzeRequest) error {
 	return nil
 }
 
+// validateRef accepts branch and tag names, the empty ref is the default
+// branch
+func validateRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if len(ref) > 255 || strings.HasPrefix(ref, "-") || strings.Contains(ref, "..") ||
+		containsUnsafeChars(ref) || strings.ContainsAny(ref, " ~^:?*\\") {
+		return fmt.Errorf("invalid ref")
+	}
+	return nil
+}
+
 func containsUnsafeChars(s string) bool {
 	return strings.ContainsAny(s, ";|&$`(){}[]<>\"'")
 }
@@ -252,8 +567,8 @@ func isNotFoundError(err error) bool {
 		strings.Contains(errStr, "remote: Repository not found")
 }
 
-func fetchGitHubRepoInfo(username, repo string) (*GitHubRepo, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", username, repo)
+// newGitHubRequest builds an authenticated GET request against the GitHub API
+func newGitHubRequest(url string) (*http.Request, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -264,6 +579,16 @@ func fetchGitHubRepoInfo(username, repo string) (*GitHubRepo, error) {
 	}
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
+	return req, nil
+}
+
+func fetchGitHubRepoInfo(username, repo string) (*api.GitHubRepo, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", username, repo)
+	req, err := newGitHubRequest(url)
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := githubClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -274,7 +599,7 @@ func fetchGitHubRepoInfo(username, repo string) (*GitHubRepo, error) {
 		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
 	}
 
-	var repoInfo GitHubRepo
+	var repoInfo api.GitHubRepo
 	if err := json.NewDecoder(resp.Body).Decode(&repoInfo); err != nil {
 		return nil, err
 	}
@@ -282,20 +607,15 @@ func fetchGitHubRepoInfo(username, repo string) (*GitHubRepo, error) {
 	return &repoInfo, nil
 }
 
-func fetchRepoTopPullRequests(username, repo string) (*GitHubSearchResult, error) {
+func fetchRepoTopPullRequests(username, repo string) (*api.GitHubSearchResult, error) {
 	const prCount = 5
 	searchURL := fmt.Sprintf("https://api.github.com/search/issues?q=repo:%s/%s+type:pr+created:2025-01-01..2025-12-31&sort=reactions&order=desc&per_page=%d", username, repo, prCount)
 
-	req, err := http.NewRequest("GET", searchURL, nil)
+	req, err := newGitHubRequest(searchURL)
 	if err != nil {
 		return nil, err
 	}
 
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		req.Header.Set("Authorization", "token "+token)
-	}
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
 	resp, err := githubClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -306,7 +626,7 @@ func fetchRepoTopPullRequests(username, repo string) (*GitHubSearchResult, error
 		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
 	}
 
-	var searchResult GitHubSearchResult
+	var searchResult api.GitHubSearchResult
 	if err := json.NewDecoder(resp.Body).Decode(&searchResult); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+const (
+	maxCommitQuery  = 200
+	maxCommitAuthor = 255
+)
+
+// CommitSearchResult is a matching commit with a link to it on GitHub
+type CommitSearchResult struct {
+	database.CommitMatch
+	URL string `json:"url"`
+}
+
+// SearchRepoCommits searches the full messages of the stored commits of an
+// analyzed repository. ?author= matches the author name, ?from= and ?to= take
+// dates or RFC 3339 times, ?order=asc|desc sorts by date instead of
+// relevance and ?limit= with ?offset= pages the matches.
+func SearchRepoCommits(c *fiber.Ctx) error {
+	owner, repo := c.Params("owner"), c.Params("repo")
+	if err := validateRequest(api.AnalyzeRequest{Username: owner, Repo: repo}); err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	query := database.CommitSearchQuery{
+		Query:  c.Query("q"),
+		Author: c.Query("author"),
+		Order:  c.Query("order"),
+		Limit:  c.QueryInt("limit", database.DefaultCommitMatches),
+		Offset: c.QueryInt("offset", 0),
+	}
+	if query.Query == "" || len(query.Query) > maxCommitQuery {
+		return middleware.ValidationError(c, fmt.Sprintf("q must be between 1 and %d characters", maxCommitQuery))
+	}
+	if len(query.Author) > maxCommitAuthor {
+		return middleware.ValidationError(c, "author is too long")
+	}
+	if query.Order != database.OrderOldest && query.Order != database.OrderNewest && query.Order != database.OrderRelevance {
+		return middleware.ValidationError(c, "order must be asc or desc")
+	}
+	if query.Limit <= 0 || query.Limit > database.MaxCommitMatches {
+		return middleware.ValidationError(c, fmt.Sprintf("limit must be between 1 and %d", database.MaxCommitMatches))
+	}
+	if query.Offset < 0 {
+		return middleware.ValidationError(c, "offset must not be negative")
+	}
+
+	var err error
+	if query.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		return middleware.ValidationError(c, "from must be a date (2006-01-02) or an RFC 3339 time")
+	}
+	if query.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		return middleware.ValidationError(c, "to must be a date (2006-01-02) or an RFC 3339 time")
+	}
+
+	repoData, err := database.GetRepo(owner, repo)
+	if err != nil {
+		log.Printf("Failed to get repo %s/%s: %v", owner, repo, err)
+		return middleware.InternalError(c, "Failed to search commits")
+	}
+	if repoData == nil {
+		return middleware.NotFoundError(c, "Repository has not been analyzed yet")
+	}
+
+	matches, err := database.SearchCommits(owner, repo, query)
+	if err != nil {
+		log.Printf("Failed to search commits of %s/%s: %v", owner, repo, err)
+		return middleware.InternalError(c, "Failed to search commits")
+	}
+
+	results := make([]CommitSearchResult, 0, len(matches))
+	for _, match := range matches {
+		results = append(results, CommitSearchResult{
+			CommitMatch: match,
+			URL:         fmt.Sprintf("https://github.com/%s/%s/commit/%s", repoData.Username, repoData.RepoName, match.SHA),
+		})
+	}
+
+	// A full page means there can be more
+	var nextOffset *int
+	if len(results) == query.Limit {
+		next := query.Offset + query.Limit
+		nextOffset = &next
+	}
+
+	return c.JSON(fiber.Map{
+		"query":      query.Query,
+		"commits":    results,
+		"nextOffset": nextOffset,
+	})
+}
+
+// parseSearchTime parses a ?from= or ?to= bound, a date as ?to= includes the
+// whole day
+func parseSearchTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
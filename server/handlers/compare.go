@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+	"github.com/immatheus/gitback/storage"
+)
+
+const (
+	maxCompareRepos = 5
+	// Points of the growth curves
+	defaultComparePoints = 20
+	maxComparePoints     = 100
+	// Months of recent activity
+	activityMonths = 12
+)
+
+// CompareRepo is one repository of a comparison, Error is set instead of
+// the metrics when it could not be analyzed and Pending when it wasn't
+// analyzed yet
+type CompareRepo struct {
+	Repo    string `json:"repo"`
+	Error   string `json:"error,omitempty"`
+	Pending bool   `json:"pending,omitempty"`
+	*CompareMetrics
+}
+
+// CompareMetrics are the numbers of a repository lined up for comparison
+type CompareMetrics struct {
+	Commits      int   `json:"commits"`
+	Added        int   `json:"added"`
+	Removed      int   `json:"removed"`
+	LOC          int   `json:"loc"`
+	Contributors int   `json:"contributors"`
+	Stars        *int  `json:"stars"` // nil when GitHub had no info
+	FirstCommit  int64 `json:"firstCommit"`
+	LastCommit   int64 `json:"lastCommit"`
+	AgeDays      int   `json:"ageDays"`
+	// Lines of code from the first to the last commit in equally long steps,
+	// so repos of different age line up
+	Growth []int `json:"growth"`
+	// Commits per month, aligned with the months of the comparison
+	Activity []int `json:"activity"`
+	Stale    bool  `json:"stale,omitempty"`
+}
+
+// CompareRepos analyzes up to maxCompareRepos repositories, ?repos=a/b,c/d,
+// and returns their metrics side by side. ?points= sets the points of the
+// growth curves.
+func CompareRepos(c *fiber.Ctx) error {
+	targets, err := parseCompareRepos(c.Query("repos"))
+	if err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	points := c.QueryInt("points", defaultComparePoints)
+	if points < 1 || points > maxComparePoints {
+		return middleware.ValidationError(c, fmt.Sprintf("points must be between 1 and %d", maxComparePoints))
+	}
+
+	analyses := make([]*storage.CachedAnalysis, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target analysisTarget) {
+			defer wg.Done()
+			analyses[i] = cachedAnalysis(target, false)
+		}(i, target)
+	}
+	wg.Wait()
+
+	// A request analyzes at most one repo, like the single repo endpoints, so
+	// comparing doesn't multiply the analyze rate limit. The other uncached
+	// repos are pending and analyzed by the next requests.
+	errs := make([]error, len(targets))
+	pending := make([]bool, len(targets))
+	analyzed := false
+	for i, target := range targets {
+		if analyses[i] != nil {
+			continue
+		}
+		if analyzed {
+			pending[i] = true
+			continue
+		}
+		analyzed = true
+		analyses[i], errs[i] = loadAnalysis(target, false)
+	}
+
+	// Months run up to the current one, so the response changes with the month
+	months := make([]int64, activityMonths)
+	start := database.IntervalMonth.Start(time.Now()).AddDate(0, 1-activityMonths, 0)
+	for i := range months {
+		months[i] = start.AddDate(0, i, 0).Unix()
+	}
+
+	// Failed and pending repos may work on the next try, so only complete
+	// comparisons are cached, and only as long as every analysis in them is
+	// fresh
+	cacheable := true
+	maxAge := time.Duration(-1)
+	tag := sha256.New()
+	fmt.Fprintf(tag, "%d.%d", points, months[0])
+	for i, analysis := range analyses {
+		if errs[i] != nil || pending[i] {
+			cacheable = false
+			continue
+		}
+		fmt.Fprintf(tag, ".%s.%t", analysis.ETag, analysis.Stale)
+		if age := time.Until(analysis.Updated.Add(analysis.TTL)); maxAge < 0 || age < maxAge {
+			maxAge = age
+		}
+	}
+
+	if cacheable {
+		etag := hex.EncodeToString(tag.Sum(nil)[:16])
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+		c.Set(fiber.HeaderETag, fmt.Sprintf("W/%q", etag))
+		if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+	}
+
+	repos := make([]CompareRepo, len(targets))
+	for i, target := range targets {
+		repos[i] = CompareRepo{Repo: target.Username + "/" + target.Repo}
+		if pending[i] {
+			repos[i].Pending = true
+			continue
+		}
+		if errs[i] != nil {
+			_, repos[i].Error = analysisFailure(errs[i])
+			continue
+		}
+
+		result, err := analyses[i].Result()
+		if err != nil {
+			log.Printf("Failed to decode cached analysis of %s: %v", target, err)
+			repos[i].Error = "Failed to read analysis"
+			continue
+		}
+
+		metrics := compareMetrics(result, points, months)
+		metrics.Stale = analyses[i].Stale
+		repos[i].CompareMetrics = metrics
+	}
+
+	return c.JSON(fiber.Map{
+		"months": months,
+		"repos":  repos,
+	})
+}
+
+// parseCompareRepos reads a comma separated list of owner/repo names,
+// repeated names are dropped
+func parseCompareRepos(value string) ([]analysisTarget, error) {
+	var targets []analysisTarget
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid repository %q, expected owner/repo", name)
+		}
+		if err := validateRequest(api.AnalyzeRequest{Username: owner, Repo: repo}); err != nil {
+			return nil, fmt.Errorf("invalid repository %q: %w", name, err)
+		}
+
+		seen[strings.ToLower(name)] = true
+		targets = append(targets, analysisTarget{Username: owner, Repo: repo})
+	}
+
+	if len(targets) < 1 || len(targets) > maxCompareRepos {
+		return nil, fmt.Errorf("repos must list between 1 and %d repositories", maxCompareRepos)
+	}
+	return targets, nil
+}
+
+func compareMetrics(result *api.AnalysisResult, points int, months []int64) *CompareMetrics {
+	metrics := &CompareMetrics{
+		Commits:      result.TotalCommits,
+		Added:        result.TotalAdded,
+		Removed:      result.TotalRemoved,
+		LOC:          result.TotalAdded - result.TotalRemoved,
+		Contributors: result.TotalContributors,
+		Growth:       database.CalculateLinesHistogram(result.Commits, points),
+		Activity:     make([]int, len(months)),
+	}
+	if result.GitHub != nil {
+		stars := result.GitHub.StargazersCount
+		metrics.Stars = &stars
+	}
+
+	monthIndex := make(map[int64]int, len(months))
+	for i, month := range months {
+		monthIndex[month] = i
+	}
+
+	for i, commit := range result.Commits {
+		if i == 0 || commit.Date < metrics.FirstCommit {
+			metrics.FirstCommit = commit.Date
+		}
+		if commit.Date > metrics.LastCommit {
+			metrics.LastCommit = commit.Date
+		}
+		month := database.IntervalMonth.Start(time.Unix(commit.Date, 0)).Unix()
+		if index, ok := monthIndex[month]; ok {
+			metrics.Activity[index]++
+		}
+	}
+	metrics.AgeDays = int((metrics.LastCommit - metrics.FirstCommit) / 86400)
+
+	return metrics
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	"github.com/immatheus/gitback/middleware"
+	"github.com/immatheus/gitback/storage"
+)
+
+const (
+	defaultContributors = 100
+	// Profiles kept with an analysis, the most ?limit= can ask for
+	maxContributors = 1000
+)
+
+// GetRepoContributors lists the contributor profiles of a repository, most
+// commits first. ?limit= caps the list, ?ref= works like on GetRepoAnalysis.
+func GetRepoContributors(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultContributors)
+	if limit <= 0 || limit > maxContributors {
+		return middleware.ValidationError(c, fmt.Sprintf("limit must be between 1 and %d", maxContributors))
+	}
+
+	analysis, profiles, err := requestedContributors(c)
+	if profiles == nil {
+		return err
+	}
+
+	return sendDerived(c, analysis, fmt.Sprintf("contributors.%d", limit), func() (fiber.Map, error) {
+		list := profiles.Contributors
+		if len(list) > limit {
+			list = list[:limit]
+		}
+		return fiber.Map{
+			"contributors": list,
+			"total":        profiles.Total,
+		}, nil
+	})
+}
+
+// GetRepoContributor returns the profile of one contributor, :id is the id
+// listed by GetRepoContributors
+func GetRepoContributor(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" || len(id) > 64 || containsUnsafeChars(id) {
+		return middleware.ValidationError(c, "invalid contributor id")
+	}
+
+	analysis, profiles, err := requestedContributors(c)
+	if profiles == nil {
+		return err
+	}
+
+	return sendDerived(c, analysis, "contributor."+id, func() (fiber.Map, error) {
+		for _, profile := range profiles.Contributors {
+			if profile.ID == id {
+				return fiber.Map{"contributor": profile}, nil
+			}
+		}
+		return nil, &notFoundError{"Contributor not found"}
+	})
+}
+
+// requestedContributors loads the contributor profiles of the requested
+// analysis, cached next to it. Analyses cached without them are analyzed
+// again. It returns nil profiles after sending an error response.
+func requestedContributors(c *fiber.Ctx) (*storage.CachedAnalysis, *api.ContributorProfiles, error) {
+	target, analysis, err := requestedAnalysis(c)
+	if analysis == nil {
+		return nil, nil, err
+	}
+
+	data := analysis.Contributors
+	if data == nil {
+		if data, err = storage.GetContributors(target.Username, target.Repo, target.Ref, analysis); err != nil {
+			log.Printf("Failed to read cached contributors of %s: %v", target, err)
+		}
+	}
+	if data == nil {
+		log.Printf("No contributors cached with the analysis of %s, re-analyzing", target)
+		if analysis, err = analyze(target, false); err != nil {
+			return nil, nil, analysisError(c, err)
+		}
+		data = analysis.Contributors
+	}
+
+	var profiles api.ContributorProfiles
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		log.Printf("Failed to decode contributors of %s: %v", target, err)
+		return nil, nil, middleware.InternalError(c, "Failed to read contributors")
+	}
+	return analysis, &profiles, nil
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/storage"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Response formats of an analysis. JSON is the cached form, the others are
+// derived from it on request and carry the commits column by column.
+const (
+	formatJSON     = "json"
+	formatColumnar = "columnar"
+	formatMsgpack  = "msgpack"
+
+	MIMEColumnarJSON = "application/vnd.gitback.columnar+json"
+	MIMEMsgpack      = "application/msgpack"
+)
+
+// ColumnarCommits stores commits as parallel arrays, index i of every array
+// belongs to the same commit. Authors are stored once and referenced by
+// index, dates are unix seconds where every entry after the first is the
+// difference to the previous commit.
+type ColumnarCommits struct {
+	Authors  []string `json:"authors"`
+	Hash     []string `json:"hash"`
+	Author   []int    `json:"author"`
+	Date     []int64  `json:"date"`
+	Added    []int    `json:"added"`
+	Removed  []int    `json:"removed"`
+	Files    []int    `json:"files"`
+	Messages []string `json:"message"`
+}
+
+// NewColumnarCommits converts commits to the columnar layout
+func NewColumnarCommits(commits []database.CommitStats) *ColumnarCommits {
+	columns := &ColumnarCommits{
+		Authors:  []string{},
+		Hash:     make([]string, len(commits)),
+		Author:   make([]int, len(commits)),
+		Date:     make([]int64, len(commits)),
+		Added:    make([]int, len(commits)),
+		Removed:  make([]int, len(commits)),
+		Files:    make([]int, len(commits)),
+		Messages: make([]string, len(commits)),
+	}
+
+	authorIndex := make(map[string]int)
+	var previousDate int64
+	for i, commit := range commits {
+		index, ok := authorIndex[commit.Author]
+		if !ok {
+			index = len(columns.Authors)
+			authorIndex[commit.Author] = index
+			columns.Authors = append(columns.Authors, commit.Author)
+		}
+
+		columns.Hash[i] = commit.Hash
+		columns.Author[i] = index
+		columns.Date[i] = commit.Date - previousDate
+		columns.Added[i] = commit.Added
+		columns.Removed[i] = commit.Removed
+		columns.Files[i] = commit.FilesTouchedCount
+		columns.Messages[i] = commit.Message
+		previousDate = commit.Date
+	}
+
+	return columns
+}
+
+// Sections of an analysis a client can pick with ?fields=, every section
+// maps to the top level keys it sends. The histogram is derived from the
+// commits and only sent when asked for.
+var analysisSections = map[string][]string{
+	"totals":       {"totalAdded", "totalRemoved", "totalContributors", "totalCommits"},
+	"commits":      {"commits"},
+	"github":       {"github"},
+	"pullRequests": {"pullRequests"},
+	"issues":       {"issues"},
+	"releases":     {"releases"},
+	"histogram":    {"linesHistogram"},
+}
+
+// Points of the histogram section, ?points= picks another count
+const (
+	defaultHistogramPoints = 10
+	maxHistogramPoints     = 1000
+)
+
+// responseOptions is how a client wants an analysis sent
+type responseOptions struct {
+	format string
+	// sections to send, nil sends all but the histogram
+	sections []string
+	// page of commits to send, nil sends all of them
+	page *commitPage
+	// points of the histogram section
+	points int
+}
+
+// wants reports whether a section was asked for explicitly
+func (o responseOptions) wants(section string) bool {
+	for _, s := range o.sections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// reshaped reports whether the stored analysis has to be changed before it
+// is sent
+func (o responseOptions) reshaped() bool {
+	return o.sections != nil || o.page != nil
+}
+
+// tag is appended to the analysis ETag so every shape is validated on its own
+func (o responseOptions) tag() string {
+	var tag string
+	if o.format != formatJSON {
+		tag += "-" + o.format
+	}
+	if o.sections != nil {
+		tag += "-" + strings.Join(append([]string{"sections"}, o.sections...), ".")
+	}
+	if o.page != nil {
+		tag += "-" + o.page.tag()
+	}
+	if o.wants("histogram") {
+		tag += fmt.Sprintf("-points.%d", o.points)
+	}
+	return tag
+}
+
+// parseResponseOptions reads the format, the sections from ?fields= (or its
+// aliases ?include= and ?sections=), a comma separated list of
+// analysisSections, the page of commits and the histogram ?points=
+func parseResponseOptions(c *fiber.Ctx) (responseOptions, error) {
+	format, err := responseFormat(c)
+	if err != nil {
+		return responseOptions{}, err
+	}
+	opts := responseOptions{format: format}
+
+	if opts.page, err = parseCommitPage(c); err != nil {
+		return responseOptions{}, err
+	}
+
+	opts.points = c.QueryInt("points", defaultHistogramPoints)
+	if opts.points < 1 || opts.points > maxHistogramPoints {
+		return responseOptions{}, fmt.Errorf("points must be between 1 and %d", maxHistogramPoints)
+	}
+
+	var value string
+	for _, param := range []string{"fields", "include", "sections"} {
+		if value = c.Query(param); value != "" {
+			break
+		}
+	}
+	if value == "" {
+		return opts, nil
+	}
+
+	opts.sections = []string{}
+	for _, section := range strings.Split(value, ",") {
+		section = strings.TrimSpace(section)
+		if section == "" || opts.wants(section) {
+			continue
+		}
+		if _, ok := analysisSections[section]; !ok {
+			return responseOptions{}, fmt.Errorf("unknown section %q, expected %s", section, strings.Join(sectionNames(), ", "))
+		}
+		opts.sections = append(opts.sections, section)
+	}
+	sort.Strings(opts.sections)
+	return opts, nil
+}
+
+func sectionNames() []string {
+	names := make([]string, 0, len(analysisSections))
+	for name := range analysisSections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Paging through the commits of a big repo asks for the same analysis over
+// and over, its decoded form is kept for the most recent ones
+const maxDecodedAnalyses = 8
+
+// decodedAnalysis is an analysis split into its top level keys with the
+// commits decoded, shared by requests and never modified
+type decodedAnalysis struct {
+	document map[string]json.RawMessage
+	commits  []database.CommitStats
+}
+
+var (
+	decodedMu       sync.Mutex
+	decodedAnalyses = make(map[string]*decodedAnalysis)
+	// ETags of decodedAnalyses, oldest first
+	decodedOrder []string
+)
+
+// decodeAnalysis returns the decoded form of an analysis, from memory when
+// it was decoded before
+func decodeAnalysis(analysis *storage.CachedAnalysis) (*decodedAnalysis, error) {
+	decodedMu.Lock()
+	decoded, ok := decodedAnalyses[analysis.ETag]
+	decodedMu.Unlock()
+	if ok {
+		return decoded, nil
+	}
+
+	data, err := analysis.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded = &decodedAnalysis{}
+	if err := json.Unmarshal(data, &decoded.document); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis: %w", err)
+	}
+	if raw, ok := decoded.document["commits"]; ok {
+		if err := json.Unmarshal(raw, &decoded.commits); err != nil {
+			return nil, fmt.Errorf("failed to decode commits: %w", err)
+		}
+	}
+
+	// Without a tag there is nothing to tell analyses apart by
+	if analysis.ETag == "" {
+		return decoded, nil
+	}
+
+	decodedMu.Lock()
+	defer decodedMu.Unlock()
+	if _, ok := decodedAnalyses[analysis.ETag]; !ok {
+		if len(decodedOrder) >= maxDecodedAnalyses {
+			delete(decodedAnalyses, decodedOrder[0])
+			decodedOrder = decodedOrder[1:]
+		}
+		decodedAnalyses[analysis.ETag] = decoded
+		decodedOrder = append(decodedOrder, analysis.ETag)
+	}
+	return decoded, nil
+}
+
+// shapeAnalysis applies the sections and the page of commits of opts to an
+// analysis and returns it as JSON
+func shapeAnalysis(analysis *storage.CachedAnalysis, opts responseOptions) ([]byte, error) {
+	decoded, err := decodeAnalysis(analysis)
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoded analysis is shared, keys are replaced on a copy
+	document := make(map[string]json.RawMessage, len(decoded.document)+1)
+	for key, value := range decoded.document {
+		document[key] = value
+	}
+	commits := decoded.commits
+
+	if opts.wants("histogram") {
+		raw, err := json.Marshal(database.CalculateLinesHistogram(commits, opts.points))
+		if err != nil {
+			return nil, err
+		}
+		document["linesHistogram"] = raw
+	}
+
+	if opts.sections != nil {
+		for section, keys := range analysisSections {
+			if opts.wants(section) {
+				continue
+			}
+			for _, key := range keys {
+				delete(document, key)
+			}
+		}
+	}
+
+	if _, ok := document["commits"]; ok && opts.page != nil {
+		page, next, err := opts.page.slice(commits)
+		if err != nil {
+			return nil, err
+		}
+		if document["commits"], err = json.Marshal(page); err != nil {
+			return nil, err
+		}
+		// null on the last page
+		document["nextCursor"] = json.RawMessage("null")
+		if next != "" {
+			if document["nextCursor"], err = json.Marshal(next); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(document)
+}
+
+// responseFormat reads the wanted format from ?format= or else the Accept
+// header, JSON stays the default
+func responseFormat(c *fiber.Ctx) (string, error) {
+	switch format := c.Query("format"); format {
+	case "":
+	case formatJSON, formatColumnar, formatMsgpack:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected json, columnar or msgpack", format)
+	}
+
+	switch c.Accepts(fiber.MIMEApplicationJSON, MIMEColumnarJSON, MIMEMsgpack, "application/x-msgpack") {
+	case MIMEColumnarJSON:
+		return formatColumnar, nil
+	case MIMEMsgpack, "application/x-msgpack":
+		return formatMsgpack, nil
+	}
+	return formatJSON, nil
+}
+
+// formatContentType is the Content-Type a format is sent with
+func formatContentType(format string) string {
+	switch format {
+	case formatColumnar:
+		return MIMEColumnarJSON
+	case formatMsgpack:
+		return MIMEMsgpack
+	}
+	return fiber.MIMEApplicationJSON
+}
+
+// encodeFormat converts an analysis encoded as JSON to the columnar or
+// MessagePack format
+func encodeFormat(data []byte, format string) ([]byte, error) {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis: %w", err)
+	}
+
+	var columns *ColumnarCommits
+	if raw, ok := document["commits"]; ok {
+		var commits []database.CommitStats
+		if err := json.Unmarshal(raw, &commits); err != nil {
+			return nil, fmt.Errorf("failed to decode commits: %w", err)
+		}
+		columns = NewColumnarCommits(commits)
+	}
+
+	if format == formatColumnar {
+		if columns != nil {
+			raw, err := json.Marshal(columns)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode commits: %w", err)
+			}
+			document["commits"] = raw
+		}
+		return json.Marshal(document)
+	}
+
+	values := make(map[string]interface{}, len(document))
+	for key, raw := range document {
+		if key == "commits" && columns != nil {
+			values[key] = columns
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		values[key] = jsonNumbers(value)
+	}
+
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	encoder.SetSortMapKeys(true)
+	if err := encoder.Encode(values); err != nil {
+		return nil, fmt.Errorf("failed to encode msgpack: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// jsonNumbers turns json.Number values back into integers where possible so
+// they are packed as ints instead of strings or floats
+func jsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+const (
+	defaultHistoryRuns = 100
+	maxHistoryRuns     = 500
+)
+
+// RunDelta is the change of the headline numbers since the previous run
+type RunDelta struct {
+	TotalStars        int `json:"totalStars"`
+	TotalLines        int `json:"totalLines"`
+	TotalCommits      int `json:"totalCommits"`
+	TotalContributors int `json:"totalContributors"`
+}
+
+type HistoryEntry struct {
+	database.AnalysisRun
+	Delta *RunDelta `json:"delta,omitempty"` // nil for the first run
+}
+
+// GetRepoHistory returns every stored analysis run of a repository together
+// with the deltas between consecutive runs
+func GetRepoHistory(c *fiber.Ctx) error {
+	owner, repo := c.Params("owner"), c.Params("repo")
+	if err := validateRequest(api.AnalyzeRequest{Username: owner, Repo: repo}); err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	limit := c.QueryInt("limit", defaultHistoryRuns)
+	if limit <= 0 || limit > maxHistoryRuns {
+		return middleware.ValidationError(c, "limit must be between 1 and 500")
+	}
+
+	runs, err := database.GetAnalysisRuns(owner, repo, limit)
+	if err != nil {
+		log.Printf("Failed to get analysis runs for %s/%s: %v", owner, repo, err)
+		return middleware.InternalError(c, "Failed to fetch repository history")
+	}
+
+	history := make([]HistoryEntry, 0, len(runs))
+	for i, run := range runs {
+		entry := HistoryEntry{AnalysisRun: run}
+		if i > 0 {
+			prev := runs[i-1]
+			entry.Delta = &RunDelta{
+				TotalStars:        run.TotalStars - prev.TotalStars,
+				TotalLines:        run.TotalLines - prev.TotalLines,
+				TotalCommits:      run.TotalCommits - prev.TotalCommits,
+				TotalContributors: run.TotalContributors - prev.TotalContributors,
+			}
+		}
+		history = append(history, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"runs": history,
+	})
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/immatheus/gitback/api"
+)
+
+const (
+	issuesPerPage = 100
+	// 300 most recent issues, every analysis waits for them and shares the
+	// GitHub rate limit with the other requests
+	maxIssuePages = 3
+	// Without a token GitHub allows 60 requests an hour
+	anonymousIssuePages = 1
+	topIssueLabels      = 10
+	topReporters        = 10
+)
+
+type GitHubIssue struct {
+	Number      int                        `json:"number"`
+	User        api.GitHubUser             `json:"user"`
+	State       string                     `json:"state"`
+	CreatedAt   string                     `json:"created_at"`
+	ClosedAt    *string                    `json:"closed_at"`
+	Labels      []GitHubLabel              `json:"labels"`
+	PullRequest *api.GitHubPullRequestInfo `json:"pull_request,omitempty"`
+}
+
+type GitHubLabel struct {
+	Name string `json:"name"`
+}
+
+// fetchRepoIssues pages through the issues of a repository, newest first.
+// The issues endpoint also returns pull requests, those are filtered out.
+func fetchRepoIssues(username, repo string) ([]GitHubIssue, bool, error) {
+	var issues []GitHubIssue
+
+	pages := maxIssuePages
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		pages = anonymousIssuePages
+	}
+
+	for page := 1; page <= pages; page++ {
+		url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues?state=all&sort=created&direction=desc&per_page=%d&page=%d",
+			username, repo, issuesPerPage, page)
+
+		pageIssues, err := fetchIssuePage(url)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, issue := range pageIssues {
+			if issue.PullRequest == nil {
+				issues = append(issues, issue)
+			}
+		}
+
+		if len(pageIssues) < issuesPerPage {
+			return issues, false, nil
+		}
+	}
+
+	return issues, true, nil
+}
+
+func fetchIssuePage(url string) ([]GitHubIssue, error) {
+	req, err := newGitHubRequest(url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	var issues []GitHubIssue
+	if err := json.NewDecoder(resp.Body).Decode(&issues); err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// fetchOpenIssueCount counts the issues of a repository that are open now.
+// The open_issues_count of the repo includes pull requests, search doesn't.
+func fetchOpenIssueCount(username, repo string) (int, error) {
+	searchURL := fmt.Sprintf("https://api.github.com/search/issues?q=repo:%s/%s+type:issue+state:open&per_page=1", username, repo)
+
+	req, err := newGitHubRequest(searchURL)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	var searchResult api.GitHubSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&searchResult); err != nil {
+		return 0, err
+	}
+
+	return searchResult.TotalCount, nil
+}
+
+func fetchRepoIssueStats(username, repo string) (*api.IssueStats, error) {
+	issues, truncated, err := fetchRepoIssues(username, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	openIssues := -1
+	if truncated {
+		if count, err := fetchOpenIssueCount(username, repo); err == nil {
+			openIssues = count
+		} else {
+			log.Printf("Failed to count open issues of %s/%s: %v", username, repo, err)
+		}
+	}
+
+	return CalculateIssueStats(issues, truncated, openIssues), nil
+}
+
+// CalculateIssueStats aggregates issues into monthly open/close counts, the
+// backlog over time, time to close, labels and the most active reporters.
+// truncated tells that only the most recent issues were fetched, the issues
+// still open from before them are unknown. The backlog is then counted back
+// from openIssues, the issues open now, and left out when that is -1.
+func CalculateIssueStats(issues []GitHubIssue, truncated bool, openIssues int) *api.IssueStats {
+	stats := &api.IssueStats{
+		Monthly:      []api.IssueMonth{},
+		Labels:       []api.IssueLabel{},
+		TopReporters: []api.IssueAuthor{},
+		Truncated:    truncated,
+	}
+
+	opened := make(map[string]int)
+	closed := make(map[string]int)
+	labels := make(map[string]int)
+	reporters := make(map[string]*api.IssueAuthor)
+	var closeDurations []float64
+	var first, last time.Time
+
+	for _, issue := range issues {
+		createdAt, err := time.Parse(time.RFC3339, issue.CreatedAt)
+		if err != nil {
+			continue
+		}
+
+		stats.TotalOpened++
+		opened[monthKey(createdAt)]++
+		first, last = widenRange(first, last, createdAt)
+
+		if issue.ClosedAt != nil {
+			if closedAt, err := time.Parse(time.RFC3339, *issue.ClosedAt); err == nil {
+				stats.TotalClosed++
+				closed[monthKey(closedAt)]++
+				closeDurations = append(closeDurations, closedAt.Sub(createdAt).Hours())
+				first, last = widenRange(first, last, closedAt)
+			}
+		}
+		if issue.State == "open" {
+			stats.OpenIssues++
+		}
+
+		for _, label := range issue.Labels {
+			labels[label.Name]++
+		}
+
+		if reporter, ok := reporters[issue.User.Login]; ok {
+			reporter.Issues++
+		} else {
+			reporters[issue.User.Login] = &api.IssueAuthor{User: issue.User, Issues: 1}
+		}
+	}
+
+	stats.MedianTimeToCloseHours = median(closeDurations)
+
+	if !first.IsZero() {
+		backlog := 0
+		for month := monthStart(first); !month.After(last); month = month.AddDate(0, 1, 0) {
+			key := monthKey(month)
+			backlog += opened[key] - closed[key]
+			month := api.IssueMonth{
+				Month:  key,
+				Opened: opened[key],
+				Closed: closed[key],
+			}
+			if !truncated {
+				open := backlog
+				month.Backlog = &open
+			}
+			stats.Monthly = append(stats.Monthly, month)
+		}
+	}
+
+	// The fetched issues are the newest, the last month ends with the issues
+	// open now. Closes of issues opened before the fetched ones are missed.
+	if truncated && openIssues >= 0 {
+		backlog := openIssues
+		for i := len(stats.Monthly) - 1; i >= 0; i-- {
+			open := max(backlog, 0)
+			stats.Monthly[i].Backlog = &open
+			backlog -= stats.Monthly[i].Opened - stats.Monthly[i].Closed
+		}
+	}
+
+	for name, count := range labels {
+		stats.Labels = append(stats.Labels, api.IssueLabel{Name: name, Count: count})
+	}
+	sort.Slice(stats.Labels, func(i, j int) bool {
+		if stats.Labels[i].Count != stats.Labels[j].Count {
+			return stats.Labels[i].Count > stats.Labels[j].Count
+		}
+		return stats.Labels[i].Name < stats.Labels[j].Name
+	})
+	if len(stats.Labels) > topIssueLabels {
+		stats.Labels = stats.Labels[:topIssueLabels]
+	}
+
+	for _, reporter := range reporters {
+		stats.TopReporters = append(stats.TopReporters, *reporter)
+	}
+	sort.Slice(stats.TopReporters, func(i, j int) bool {
+		if stats.TopReporters[i].Issues != stats.TopReporters[j].Issues {
+			return stats.TopReporters[i].Issues > stats.TopReporters[j].Issues
+		}
+		return stats.TopReporters[i].User.Login < stats.TopReporters[j].User.Login
+	})
+	if len(stats.TopReporters) > topReporters {
+		stats.TopReporters = stats.TopReporters[:topReporters]
+	}
+
+	return stats
+}
+
+func monthKey(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func widenRange(first, last, t time.Time) (time.Time, time.Time) {
+	if first.IsZero() || t.Before(first) {
+		first = t
+	}
+	if t.After(last) {
+		last = t
+	}
+	return first, last
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
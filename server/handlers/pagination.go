@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	database "github.com/immatheus/gitback/databases"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 5000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// commitPage is a slice of the commits of an analysis. The cursor is the
+// last commit of the previous page, so pages stay put when a refresh adds
+// newer commits.
+type commitPage struct {
+	limit int
+	// newest first instead of the stored oldest first
+	desc   bool
+	cursor string
+}
+
+// parseCommitPage reads ?limit=, ?cursor= and ?order=asc|desc, it returns
+// nil when none of them is set
+func parseCommitPage(c *fiber.Ctx) (*commitPage, error) {
+	limit, cursor, order := c.Query("limit"), c.Query("cursor"), c.Query("order")
+	if limit == "" && cursor == "" && order == "" {
+		return nil, nil
+	}
+
+	page := &commitPage{limit: defaultPageSize, cursor: cursor}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		page.limit = n
+	}
+
+	switch order {
+	case "", "asc":
+	case "desc":
+		page.desc = true
+	default:
+		return nil, fmt.Errorf("unknown order %q, expected asc or desc", order)
+	}
+
+	if cursor != "" {
+		if _, _, err := decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+func (p *commitPage) tag() string {
+	order := "asc"
+	if p.desc {
+		order = "desc"
+	}
+	return fmt.Sprintf("page.%s.%d.%s", order, p.limit, p.cursor)
+}
+
+// slice returns the commits of the page and the cursor of the next one,
+// empty on the last page. Commits are stored oldest first.
+func (p *commitPage) slice(commits []database.CommitStats) ([]database.CommitStats, string, error) {
+	ordered := commits
+	if p.desc {
+		ordered = make([]database.CommitStats, len(commits))
+		for i, commit := range commits {
+			ordered[len(commits)-1-i] = commit
+		}
+	}
+
+	start := 0
+	if p.cursor != "" {
+		hash, date, _ := decodeCursor(p.cursor)
+		start = -1
+		for i, commit := range ordered {
+			if commit.Hash == hash && commit.Date == date {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", errInvalidCursor
+		}
+	}
+
+	end := start + p.limit
+	if end >= len(ordered) {
+		return ordered[start:], "", nil
+	}
+	return ordered[start:end], encodeCursor(ordered[end-1]), nil
+}
+
+func encodeCursor(commit database.CommitStats) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", commit.Hash, commit.Date)))
+}
+
+func decodeCursor(cursor string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, errInvalidCursor
+	}
+	hash, date, ok := strings.Cut(string(raw), ":")
+	if !ok || hash == "" {
+		return "", 0, errInvalidCursor
+	}
+	timestamp, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return "", 0, errInvalidCursor
+	}
+	return hash, timestamp, nil
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/middleware"
+	"github.com/immatheus/gitback/storage"
+)
+
+// sendAnalysis writes an encoded analysis in the requested format with
+// validators so browsers and CDNs can cache it. Complete JSON goes out as
+// stored when the client accepts its encoding, the compress middleware leaves
+// responses that already have a Content-Encoding alone.
+func sendAnalysis(c *fiber.Ctx, analysis *storage.CachedAnalysis, opts responseOptions) error {
+	format := opts.format
+
+	c.Vary(fiber.HeaderAccept, fiber.HeaderAcceptEncoding)
+	setCacheHeaders(c, analysis)
+	c.Set(fiber.HeaderContentType, formatContentType(format))
+
+	tag := analysis.ETag + opts.tag()
+	if analysis.Stale {
+		tag += "-stale"
+	}
+
+	// The stored bytes keep their own tag per content coding, everything else
+	// gets a weak tag since the compress middleware may encode it
+	sendStored := format == formatJSON && !opts.reshaped() && !analysis.Stale && analysis.Encoding != storage.EncodingIdentity &&
+		c.Context().Request.Header.HasAcceptEncoding(analysis.Encoding)
+	if sendStored {
+		c.Set(fiber.HeaderETag, fmt.Sprintf("%q", tag+"-"+analysis.Encoding))
+	} else {
+		c.Set(fiber.HeaderETag, fmt.Sprintf("W/%q", tag))
+	}
+
+	if notModified(c, analysis, tag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if sendStored {
+		c.Set(fiber.HeaderContentEncoding, analysis.Encoding)
+		return c.Send(analysis.Data)
+	}
+
+	var data []byte
+	var err error
+	if opts.reshaped() {
+		data, err = shapeAnalysis(analysis, opts)
+		if errors.Is(err, errInvalidCursor) {
+			// The cursor is from another analysis, nothing here to cache
+			c.Response().Header.Del(fiber.HeaderETag)
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			return middleware.ValidationError(c, err.Error())
+		} else if err != nil {
+			log.Printf("Failed to shape analysis: %v", err)
+			return middleware.InternalError(c, "Failed to encode analysis")
+		}
+	} else if data, err = analysis.Decode(); err != nil {
+		log.Printf("Failed to decode cached analysis: %v", err)
+		return middleware.InternalError(c, "Failed to read analysis")
+	}
+
+	if analysis.Stale {
+		data = markStale(data)
+	}
+
+	if format != formatJSON {
+		if data, err = encodeFormat(data, format); err != nil {
+			log.Printf("Failed to encode analysis as %s: %v", format, err)
+			return middleware.InternalError(c, "Failed to encode analysis")
+		}
+	}
+
+	return c.Send(data)
+}
+
+// notFoundError is returned by a derive function of sendDerived for things
+// that are not in the analysis
+type notFoundError struct{ message string }
+
+func (e *notFoundError) Error() string { return e.message }
+
+// sendDerived sends a response computed from an analysis with the same
+// validators as the analysis, tag tells it apart from other derived responses.
+// derive only runs when the client doesn't have the response yet.
+func sendDerived(c *fiber.Ctx, analysis *storage.CachedAnalysis, tag string, derive func() (fiber.Map, error)) error {
+	setCacheHeaders(c, analysis)
+	tag = analysis.ETag + "-" + tag
+	if analysis.Stale {
+		tag += "-stale"
+	}
+	c.Set(fiber.HeaderETag, fmt.Sprintf("W/%q", tag))
+	if notModified(c, analysis, tag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	response, err := derive()
+	var notFound *notFoundError
+	if errors.As(err, &notFound) {
+		c.Response().Header.Del(fiber.HeaderETag)
+		return middleware.NotFoundError(c, notFound.message)
+	} else if err != nil {
+		log.Printf("Failed to derive response from analysis: %v", err)
+		return middleware.InternalError(c, "Failed to encode analysis")
+	}
+
+	if analysis.Stale {
+		response["stale"] = true
+	}
+	return c.JSON(response)
+}
+
+// setCacheHeaders lets browsers and CDNs keep a response derived from an
+// analysis until the analysis expires
+func setCacheHeaders(c *fiber.Ctx, analysis *storage.CachedAnalysis) {
+	maxAge := analysis.TTL - time.Since(analysis.Updated)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	c.Set(fiber.HeaderLastModified, analysis.Updated.UTC().Format(http.TimeFormat))
+	if analysis.Stale {
+		c.Set(fiber.HeaderAge, strconv.Itoa(int(time.Since(analysis.Updated).Seconds())))
+	}
+}
+
+// notModified checks If-None-Match against tag, or If-Modified-Since when
+// the client sent no tag
+func notModified(c *fiber.Ctx, analysis *storage.CachedAnalysis, tag string) bool {
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, tag)
+	}
+	return notModifiedSince(c.Get(fiber.HeaderIfModifiedSince), analysis.Updated)
+}
+
+// etagMatches compares If-None-Match against a tag, ignoring weak prefixes
+// and the content coding suffix added by sendAnalysis
+func etagMatches(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" || tag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		candidate = strings.Trim(strings.TrimPrefix(candidate, "W/"), `"`)
+		candidate = strings.TrimSuffix(candidate, "-"+storage.EncodingGzip)
+		candidate = strings.TrimSuffix(candidate, "-"+storage.EncodingBrotli)
+		if candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModifiedSince reports whether If-Modified-Since is at or after updated,
+// HTTP dates only have second precision
+func notModifiedSince(ifModifiedSince string, updated time.Time) bool {
+	if ifModifiedSince == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !updated.Truncate(time.Second).After(since)
+}
+
+// markStale adds "stale": true to an analysis encoded as a JSON object. It
+// isn't a field of the analysis, the cached bytes are sent without decoding.
+func markStale(data []byte) []byte {
+	body := bytes.TrimSpace(data)
+	if len(body) < 2 || body[0] != '{' {
+		return data
+	}
+
+	marked := make([]byte, 0, len(body)+16)
+	marked = append(marked, `{"stale":true`...)
+	if rest := bytes.TrimSpace(body[1:]); len(rest) > 0 && rest[0] != '}' {
+		marked = append(marked, ',')
+	}
+	return append(marked, body[1:]...)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+const (
+	defaultSearchResults = 10
+	maxSearchResults     = 25
+	maxSearchQuery       = 100
+	// GitHub allows 10 to 30 searches a minute, suggestions are kept for a while
+	forgeSearchTTL     = 10 * time.Minute
+	maxForgeSearches   = 1000
+	minForgeQueryChars = 2
+	// Searches this server sends a minute, with and without a GITHUB_TOKEN
+	forgeSearchesPerMinute          = 20
+	anonymousForgeSearchesPerMinute = 8
+	// Pause after GitHub rejected a search without saying for how long
+	defaultForgeBackoff = time.Minute
+)
+
+var githubLoginPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// SearchResult is a repo suggested for a query, Analyzed tells repos that
+// are in the database apart from ones only GitHub knows
+type SearchResult struct {
+	Username    string  `json:"username"`
+	RepoName    string  `json:"repoName"`
+	Language    string  `json:"language"`
+	Stars       int     `json:"stars"`
+	Description string  `json:"description,omitempty"`
+	Analyzed    bool    `json:"analyzed"`
+	Score       float64 `json:"score,omitempty"`
+}
+
+type forgeSearch struct {
+	results []SearchResult
+	expires time.Time
+}
+
+var (
+	forgeSearchesMu sync.Mutex
+	forgeSearches   = make(map[string]forgeSearch)
+
+	// Searches sent in the current minute and until when GitHub asked us to
+	// stop, shared by all clients so autocomplete can't use up the limit
+	forgeWindowStart  time.Time
+	forgeWindowCount  int
+	forgeBlockedUntil time.Time
+)
+
+// SearchRepos suggests repos for ?q=, analyzed repos first and then GitHub
+// results for repos that weren't analyzed yet. ?forge=false only searches
+// analyzed repos.
+func SearchRepos(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" || len(query) > maxSearchQuery {
+		return middleware.ValidationError(c, fmt.Sprintf("q must be between 1 and %d characters", maxSearchQuery))
+	}
+
+	limit := c.QueryInt("limit", defaultSearchResults)
+	if limit < 1 || limit > maxSearchResults {
+		return middleware.ValidationError(c, fmt.Sprintf("limit must be between 1 and %d", maxSearchResults))
+	}
+
+	results := []SearchResult{}
+	seen := make(map[string]bool)
+
+	matches, err := database.SearchRepos(query, limit)
+	if err != nil {
+		log.Printf("Failed to search repos for %q: %v", query, err)
+	}
+	for _, match := range matches {
+		seen[strings.ToLower(match.Username+"/"+match.RepoName)] = true
+		results = append(results, SearchResult{
+			Username: match.Username,
+			RepoName: match.RepoName,
+			Language: match.Language,
+			Stars:    match.TotalStars,
+			Analyzed: true,
+			Score:    match.Score,
+		})
+	}
+
+	if len(results) < limit && len(query) >= minForgeQueryChars && c.QueryBool("forge", true) {
+		forgeResults, err := searchGitHub(query)
+		if err != nil {
+			log.Printf("GitHub search for %q failed: %v", query, err)
+		}
+		for _, result := range forgeResults {
+			if len(results) == limit {
+				break
+			}
+			key := strings.ToLower(result.Username + "/" + result.RepoName)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			results = append(results, result)
+		}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+	return c.JSON(fiber.Map{
+		"query":   query,
+		"results": results,
+	})
+}
+
+// searchGitHub searches repository names on GitHub, "owner/name" queries
+// search the repos of that owner
+func searchGitHub(query string) ([]SearchResult, error) {
+	key := strings.ToLower(query)
+	now := time.Now()
+	forgeSearchesMu.Lock()
+	cached, ok := forgeSearches[key]
+	fresh := ok && now.Before(cached.expires)
+	allowed := fresh || allowForgeSearch(now)
+	forgeSearchesMu.Unlock()
+	if fresh {
+		return cached.results, nil
+	}
+	// Over the budget the analyzed repos are all the suggestions there are
+	if !allowed {
+		return nil, nil
+	}
+
+	terms := query + " in:name"
+	if owner, name, ok := strings.Cut(query, "/"); ok {
+		if !githubLoginPattern.MatchString(owner) {
+			return nil, nil
+		}
+		terms = "user:" + owner
+		if name = strings.TrimSpace(name); name != "" {
+			terms = name + " in:name " + terms
+		}
+	}
+
+	searchURL := fmt.Sprintf("https://api.github.com/search/repositories?q=%s&sort=stars&order=desc&per_page=%d",
+		url.QueryEscape(terms), maxSearchResults)
+	req, err := newGitHubRequest(searchURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		until := forgeBackoff(resp.Header, time.Now())
+		forgeSearchesMu.Lock()
+		forgeBlockedUntil = until
+		forgeSearchesMu.Unlock()
+		return nil, fmt.Errorf("GitHub API returned status %d, pausing searches until %s", resp.StatusCode, until.Format(time.RFC3339))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	var page api.GitHubRepoSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(page.Items))
+	for _, item := range page.Items {
+		results = append(results, SearchResult{
+			Username:    item.Owner.Login,
+			RepoName:    item.Name,
+			Language:    item.Language,
+			Stars:       item.StargazersCount,
+			Description: item.Description,
+		})
+	}
+
+	forgeSearchesMu.Lock()
+	if len(forgeSearches) >= maxForgeSearches {
+		forgeSearches = make(map[string]forgeSearch)
+	}
+	forgeSearches[key] = forgeSearch{results: results, expires: time.Now().Add(forgeSearchTTL)}
+	forgeSearchesMu.Unlock()
+
+	return results, nil
+}
+
+// allowForgeSearch counts a GitHub search against the per minute budget of
+// this server, forgeSearchesMu must be held
+func allowForgeSearch(now time.Time) bool {
+	if now.Before(forgeBlockedUntil) {
+		return false
+	}
+
+	if now.Sub(forgeWindowStart) >= time.Minute {
+		forgeWindowStart, forgeWindowCount = now, 0
+	}
+	budget := forgeSearchesPerMinute
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		budget = anonymousForgeSearchesPerMinute
+	}
+	if forgeWindowCount >= budget {
+		return false
+	}
+	forgeWindowCount++
+	return true
+}
+
+// forgeBackoff is when GitHub accepts searches again after rejecting one,
+// from Retry-After or the rate limit reset
+func forgeBackoff(header http.Header, now time.Time) time.Time {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if until := time.Unix(reset, 0); until.After(now) {
+			return until
+		}
+	}
+	return now.Add(defaultForgeBackoff)
+}
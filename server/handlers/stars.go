@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/immatheus/gitback/api"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+const (
+	stargazersPerPage = 100
+	// GitHub refuses to page past 40k stargazers
+	maxStargazerPages = 400
+	// Repos needing more pages than this get sampled, one point per page
+	maxStarPagesFetched = 30
+)
+
+type GitHubStargazer struct {
+	StarredAt string `json:"starred_at"`
+}
+
+// refreshStarHistory fetches the stargazers added since the last refresh and
+// stores them as points on the cumulative star curve
+func refreshStarHistory(username, repo string, totalStars int) error {
+	known, err := database.GetStargazersPaged(username, repo)
+	if err != nil {
+		return err
+	}
+	// Past the last page GitHub serves there is nothing to fetch until the
+	// page can advance
+	if totalStars > maxStargazerPages*stargazersPerPage {
+		totalStars = maxStargazerPages * stargazersPerPage
+	}
+	if totalStars <= known {
+		return nil
+	}
+
+	lastPage := (totalStars + stargazersPerPage - 1) / stargazersPerPage
+	// A page that wasn't full last time is fetched again, the points it
+	// already produced are skipped on insert
+	firstPage := known/stargazersPerPage + 1
+
+	pages := starPagesToFetch(firstPage, lastPage)
+	sampled := len(pages) < lastPage-firstPage+1
+
+	var points []database.StarPoint
+	paged := known
+	for _, page := range pages {
+		stargazers, err := fetchStargazerPage(username, repo, page)
+		if err != nil {
+			return err
+		}
+		paged = (page-1)*stargazersPerPage + len(stargazers)
+
+		for i, stargazer := range stargazers {
+			// When sampling only the first stargazer of each page is kept
+			if sampled && i > 0 {
+				break
+			}
+			starredAt, err := time.Parse(time.RFC3339, stargazer.StarredAt)
+			if err != nil {
+				continue
+			}
+			points = append(points, database.StarPoint{
+				Date:  starredAt.Unix(),
+				Stars: (page-1)*stargazersPerPage + i + 1,
+			})
+		}
+	}
+
+	if err := database.SaveStarHistory(username, repo, points, paged); err != nil {
+		return err
+	}
+
+	log.Printf("[STARS] Stored %d star points for %s/%s (pages %d-%d, sampled: %v)",
+		len(points), username, repo, firstPage, lastPage, sampled)
+	return nil
+}
+
+// starPagesToFetch returns the stargazer pages to request, spreading at most
+// maxStarPagesFetched pages evenly over the range when it is too large
+func starPagesToFetch(firstPage, lastPage int) []int {
+	count := lastPage - firstPage + 1
+	if count <= maxStarPagesFetched {
+		pages := make([]int, 0, count)
+		for page := firstPage; page <= lastPage; page++ {
+			pages = append(pages, page)
+		}
+		return pages
+	}
+
+	pages := make([]int, 0, maxStarPagesFetched)
+	step := float64(count-1) / float64(maxStarPagesFetched-1)
+	for i := 0; i < maxStarPagesFetched; i++ {
+		pages = append(pages, firstPage+int(float64(i)*step+0.5))
+	}
+	return pages
+}
+
+func fetchStargazerPage(username, repo string, page int) ([]GitHubStargazer, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/stargazers?per_page=%d&page=%d",
+		username, repo, stargazersPerPage, page)
+
+	req, err := newGitHubRequest(url)
+	if err != nil {
+		return nil, err
+	}
+	// This media type adds starred_at to every stargazer
+	req.Header.Set("Accept", "application/vnd.github.v3.star+json")
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	var stargazers []GitHubStargazer
+	if err := json.NewDecoder(resp.Body).Decode(&stargazers); err != nil {
+		return nil, err
+	}
+
+	return stargazers, nil
+}
+
+// GetStarHistory serves the cumulative star curve next to the LOC histogram
+func GetStarHistory(c *fiber.Ctx) error {
+	owner, repo := c.Params("owner"), c.Params("repo")
+	if err := validateRequest(api.AnalyzeRequest{Username: owner, Repo: repo}); err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	repoData, err := database.GetRepo(owner, repo)
+	if err != nil {
+		log.Printf("Failed to get repo %s/%s: %v", owner, repo, err)
+		return middleware.InternalError(c, "Failed to fetch star history")
+	}
+	if repoData == nil {
+		return middleware.NotFoundError(c, "Repository has not been analyzed yet")
+	}
+
+	points, err := database.GetStarHistory(owner, repo)
+	if err != nil {
+		log.Printf("Failed to get star history for %s/%s: %v", owner, repo, err)
+		return middleware.InternalError(c, "Failed to fetch star history")
+	}
+
+	// Past 40k stars GitHub stops paging, the current count closes the curve
+	if len(points) > 0 && points[len(points)-1].Stars < repoData.TotalStars {
+		points = append(points, database.StarPoint{Date: time.Now().Unix(), Stars: repoData.TotalStars})
+	}
+
+	return c.JSON(fiber.Map{
+		"totalStars":     repoData.TotalStars,
+		"stars":          points,
+		"linesHistogram": repoData.LinesHistogram,
+	})
+}
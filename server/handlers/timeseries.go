@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+// Metrics of the timeseries endpoint
+var timeseriesMetrics = map[string]func(*database.Timeseries) []int{
+	"commits": func(s *database.Timeseries) []int { return s.Commits },
+	"added":   func(s *database.Timeseries) []int { return s.Added },
+	"removed": func(s *database.Timeseries) []int { return s.Removed },
+	"authors": func(s *database.Timeseries) []int { return s.Authors },
+	"loc":     func(s *database.Timeseries) []int { return s.LOC },
+}
+
+// GetRepoTimeseries buckets the commits of a repository by day, week or
+// month so clients don't have to download every commit for the graphs.
+// ?metric= picks the metrics, ?ref= works like on GetRepoAnalysis.
+func GetRepoTimeseries(c *fiber.Ctx) error {
+	interval, err := database.ParseInterval(c.Query("interval", string(database.IntervalWeek)))
+	if err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	metrics, err := parseMetrics(c.Query("metric", "commits"))
+	if err != nil {
+		return middleware.ValidationError(c, err.Error())
+	}
+
+	_, analysis, err := requestedAnalysis(c)
+	if analysis == nil {
+		return err
+	}
+
+	tag := fmt.Sprintf("timeseries.%s.%s", interval, strings.Join(metrics, "."))
+	return sendDerived(c, analysis, tag, func() (fiber.Map, error) {
+		result, err := analysis.Result()
+		if err != nil {
+			return nil, err
+		}
+		series := database.CalculateTimeseries(result.Commits, interval)
+		response := fiber.Map{
+			"interval": series.Interval,
+			"dates":    series.Dates,
+		}
+		for _, metric := range metrics {
+			response[metric] = timeseriesMetrics[metric](series)
+		}
+		return response, nil
+	})
+}
+
+// parseMetrics reads a comma separated list of timeseriesMetrics
+func parseMetrics(value string) ([]string, error) {
+	seen := make(map[string]bool)
+	var metrics []string
+	for _, metric := range strings.Split(value, ",") {
+		metric = strings.TrimSpace(metric)
+		if metric == "" || seen[metric] {
+			continue
+		}
+		if _, ok := timeseriesMetrics[metric]; !ok {
+			return nil, fmt.Errorf("unknown metric %q, expected commits, added, removed, authors or loc", metric)
+		}
+		seen[metric] = true
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("metric must not be empty")
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
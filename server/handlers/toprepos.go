@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+// Points of the top repos sparklines unless ?points= asks for others
+const defaultSparklinePoints = 10
+
+// GetTopRepos lists the analyzed repos. ?sort= orders them by lines, stars,
+// views, commits or recent, ?language=, ?owner=, ?featured=true and
+// ?minStars= style bounds filter them, ?limit= and ?cursor= page them.
+func GetTopRepos(c *fiber.Ctx) error {
+	// Sparklines are small, the stored histogram is resampled to ?points=
+	points, err := queryInt(c, "points", defaultSparklinePoints)
+	if err != nil || points < 1 || points > database.HistogramPoints {
+		return middleware.ValidationError(c, fmt.Sprintf("points must be between 1 and %d", database.HistogramPoints))
+	}
+
+	query := database.TopReposQuery{
+		Sort:     c.Query("sort"),
+		Language: c.Query("language"),
+		Owner:    c.Query("owner"),
+		Featured: c.QueryBool("featured"),
+		Cursor:   c.Query("cursor"),
+	}
+	if query.Limit, err = queryInt(c, "limit", database.DefaultTopRepos); err != nil {
+		return middleware.ValidationError(c, fmt.Sprintf("limit must be between 1 and %d", database.MaxTopRepos))
+	}
+	if query.Owner != "" && (len(query.Owner) > 100 || containsUnsafeChars(query.Owner)) {
+		return middleware.ValidationError(c, "invalid owner")
+	}
+	if len(query.Language) > 100 {
+		return middleware.ValidationError(c, "invalid language")
+	}
+
+	for _, bound := range []struct {
+		param string
+		value *int
+	}{
+		{"minLines", &query.MinLines}, {"maxLines", &query.MaxLines},
+		{"minStars", &query.MinStars}, {"maxStars", &query.MaxStars},
+		{"minViews", &query.MinViews}, {"maxViews", &query.MaxViews},
+		{"minCommits", &query.MinCommits}, {"maxCommits", &query.MaxCommits},
+	} {
+		value, err := queryInt(c, bound.param, 0)
+		if err != nil {
+			return middleware.ValidationError(c, bound.param+" must be a number")
+		}
+		if value < 0 {
+			return middleware.ValidationError(c, bound.param+" must not be negative")
+		}
+		*bound.value = value
+	}
+
+	repos, next, err := database.GetTopRepos(query)
+	var queryErr *database.QueryError
+	if errors.Is(err, database.ErrInvalidCursor) || errors.As(err, &queryErr) {
+		return middleware.ValidationError(c, err.Error())
+	}
+	if err != nil {
+		log.Printf("Failed to get top repos: %v", err)
+		return middleware.InternalError(c, "Failed to fetch top repositories")
+	}
+
+	for i := range repos {
+		repos[i].LinesHistogram = database.ResampleHistogram(repos[i].LinesHistogram, points)
+	}
+
+	response := fiber.Map{
+		"repos":      repos,
+		"nextCursor": nil,
+	}
+	if next != "" {
+		response["nextCursor"] = next
+	}
+	return c.JSON(response)
+}
+
+// queryInt reads an integer query parameter, fallback when it is missing.
+// Unlike c.QueryInt it reports ?minStars=abc instead of reading it as 0.
+func queryInt(c *fiber.Ctx, param string, fallback int) (int, error) {
+	value := c.Query(param)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
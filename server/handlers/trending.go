@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/middleware"
+)
+
+const (
+	defaultTrendingRepos = 20
+	maxTrendingRepos     = 100
+)
+
+// Windows of the trending endpoint
+var trendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+var (
+	viewSalt     []byte
+	viewSaltOnce sync.Once
+)
+
+// GetTrendingRepos ranks repos by their views in ?window=24h|7d|30d and how
+// much those grew against the window before
+func GetTrendingRepos(c *fiber.Ctx) error {
+	name := c.Query("window", "24h")
+	window, ok := trendingWindows[name]
+	if !ok {
+		return middleware.ValidationError(c, fmt.Sprintf("unknown window %q, expected 24h, 7d or 30d", name))
+	}
+
+	limit := c.QueryInt("limit", defaultTrendingRepos)
+	if limit < 1 || limit > maxTrendingRepos {
+		return middleware.ValidationError(c, fmt.Sprintf("limit must be between 1 and %d", maxTrendingRepos))
+	}
+
+	repos, err := database.GetTrendingRepos(window, limit)
+	if err != nil {
+		log.Printf("Failed to get trending repos: %v", err)
+		return middleware.InternalError(c, "Failed to fetch trending repositories")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{
+		"window": name,
+		"repos":  repos,
+	})
+}
+
+// recordView stores a view event in the background, clients are identified
+// by a salted hash of their address and user agent
+func recordView(c *fiber.Ctx, username, repoName string) {
+	clientHash := viewClientHash(c)
+	go func() {
+		if err := database.RecordView(username, repoName, clientHash, time.Now()); err != nil {
+			log.Printf("[DB] Failed to record view of %s/%s: %v", username, repoName, err)
+		}
+	}()
+}
+
+func viewClientHash(c *fiber.Ctx) string {
+	viewSaltOnce.Do(func() {
+		// Instances sharing a database need the same salt to dedupe views
+		if salt := os.Getenv("VIEW_HASH_SALT"); salt != "" {
+			viewSalt = []byte(salt)
+			return
+		}
+		viewSalt = make([]byte, 32)
+		rand.Read(viewSalt)
+	})
+
+	// IP only reads proxy headers sent by TRUSTED_PROXIES
+	hash := sha256.New()
+	hash.Write(viewSalt)
+	hash.Write([]byte(c.IP()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Get(fiber.HeaderUserAgent)))
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
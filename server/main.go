@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,6 +14,7 @@ import (
 	"github.com/joho/godotenv"
 
 	database "github.com/immatheus/gitback/databases"
+	"github.com/immatheus/gitback/git"
 	"github.com/immatheus/gitback/handlers"
 	"github.com/immatheus/gitback/middleware"
 	"github.com/immatheus/gitback/storage"
@@ -20,27 +23,58 @@ import (
 func main() {
 	godotenv.Load() // only for dev, gcp injects this for us
 
-	if err := database.Init(os.Getenv("DATABASE_URL")); err != nil {
+	if err := database.Init(os.Getenv("DATABASE_URL")); errors.Is(err, database.ErrSchemaTooNew) {
+		log.Fatalf("ERROR: Refusing to start: %v", err)
+	} else if err != nil {
 		log.Printf("ERROR: Database initialization failed: %v", err)
 		log.Printf("Continuing without database - data will not be persisted")
 	} else {
 		log.Printf("Database initialized successfully")
+		database.StartViewRollup()
+		go func() {
+			if updated, err := database.BackfillHistograms(); err != nil {
+				log.Printf("[DB] Failed to backfill lines histograms: %v", err)
+			} else if updated > 0 {
+				log.Printf("[DB] Backfilled %d lines histograms", updated)
+			}
+		}()
 	}
 	defer database.Close()
 
-	if err := storage.Init(); err != nil {
+	if err := storage.Init(git.AnalyzerVersion); err != nil {
 		log.Printf("WARNING: Storage cache initialization failed: %v", err)
 		log.Printf("Continuing without cache - requests will be slower")
 	} else {
-		log.Printf("GCP Storage cache initialized successfully")
+		log.Printf("Storage cache initialized successfully")
+		storage.StartSweeper()
 	}
 	defer storage.Close()
 
+	// Proxy headers name the client address, so they are only read from the
+	// proxies in TRUSTED_PROXIES, anyone else could pick their own address
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	proxyHeader := ""
+	if len(trustedProxies) > 0 {
+		proxyHeader = os.Getenv("PROXY_HEADER")
+		if proxyHeader == "" {
+			proxyHeader = fiber.HeaderXForwardedFor
+		}
+	}
+
 	app := fiber.New(fiber.Config{
-		AppName:      "GitBack v2.0.0",
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		AppName:                 "GitBack v2.0.0",
+		ProxyHeader:             proxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trustedProxies,
+		EnableIPValidation:      true,
+		ReadTimeout:             30 * time.Second,
+		WriteTimeout:            30 * time.Second,
+		IdleTimeout:             120 * time.Second,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			log.Printf("Unhandled error: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -77,9 +111,9 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, If-None-Match, If-Modified-Since",
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
-		ExposeHeaders:    "Content-Length",
+		ExposeHeaders:    "Content-Length, ETag, Last-Modified, Age",
 		AllowCredentials: false,
 	}))
 
@@ -95,7 +129,17 @@ func main() {
 	// API routes with rate limiting
 	api := app.Group("/api", generalRateLimit)
 	api.Post("/analyze", analyzeRateLimit, handlers.AnalyzeRepo)
-	api.Get("/top-repos", getTopRepos)
+	api.Get("/top-repos", handlers.GetTopRepos)
+	api.Get("/trending", handlers.GetTrendingRepos)
+	api.Get("/search", handlers.SearchRepos)
+	api.Get("/compare", analyzeRateLimit, handlers.CompareRepos)
+	api.Get("/repos/:owner/:repo", analyzeRateLimit, handlers.GetRepoAnalysis)
+	api.Get("/repos/:owner/:repo/stars", handlers.GetStarHistory)
+	api.Get("/repos/:owner/:repo/history", handlers.GetRepoHistory)
+	api.Get("/repos/:owner/:repo/commits/search", handlers.SearchRepoCommits)
+	api.Get("/repos/:owner/:repo/timeseries", analyzeRateLimit, handlers.GetRepoTimeseries)
+	api.Get("/repos/:owner/:repo/contributors", analyzeRateLimit, handlers.GetRepoContributors)
+	api.Get("/repos/:owner/:repo/contributors/:id", analyzeRateLimit, handlers.GetRepoContributor)
 
 	// Root endpoint
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -113,16 +157,3 @@ func main() {
 	log.Printf("Starting GitBack server on port %s", port)
 	log.Fatal(app.Listen(":" + port))
 }
-
-// getTopRepos handles the top repositories endpoint
-func getTopRepos(c *fiber.Ctx) error {
-	repos, err := database.GetTopRepos()
-	if err != nil {
-		log.Printf("Failed to get top repos: %v", err)
-		return middleware.InternalError(c, "Failed to fetch top repositories")
-	}
-
-	return c.JSON(fiber.Map{
-		"repos": repos,
-	})
-}
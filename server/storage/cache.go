@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/immatheus/gitback/api"
+)
+
+// ErrNotFound is returned by cache backends when a key does not exist
+var ErrNotFound = errors.New("cache object not found")
+
+// ObjectInfo describes a cached object without its contents
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	Updated  time.Time
+	Metadata map[string]string
+}
+
+// Cache is implemented by every cache backend
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error)
+	Put(ctx context.Context, key string, data []byte, metadata map[string]string) error
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Close() error
+}
+
+const (
+	defaultCacheDir      = "tmp/cache"
+	defaultCacheMemoryMB = 256
+	defaultMaxStale      = 7 * 24 * time.Hour
+)
+
+var (
+	cache Cache
+	ctx   = context.Background()
+
+	// maxStale is how long past its TTL an analysis is still served
+	// while it is refreshed in the background
+	maxStale = defaultMaxStale
+
+	// analyzerVersion is the analyzer version this server writes, set by Init
+	analyzerVersion int
+)
+
+// Init picks the cache backend from CACHE_BACKEND (gcs, fs, memory or s3).
+// When it is not set GCS is used if GCP_BUCKET_NAME is, otherwise the local
+// filesystem, so local and on-prem setups still get a cache. analyzer is the
+// version of the commit analysis, cached objects record it.
+func Init(analyzer int) error {
+	analyzerVersion = analyzer
+
+	backend := os.Getenv("CACHE_BACKEND")
+	if backend == "" {
+		backend = "fs"
+		if os.Getenv("GCP_BUCKET_NAME") != "" {
+			backend = "gcs"
+		}
+	}
+
+	var err error
+	switch backend {
+	case "gcs":
+		cache, err = newGCSCache(os.Getenv("GCP_BUCKET_NAME"))
+	case "fs":
+		dir := os.Getenv("CACHE_DIR")
+		if dir == "" {
+			dir = defaultCacheDir
+		}
+		cache, err = newFilesystemCache(dir)
+	case "memory":
+		cache = newMemoryCache(envInt("CACHE_MEMORY_MB", defaultCacheMemoryMB) * 1024 * 1024)
+	case "s3":
+		cache, err = newS3Cache(s3ConfigFromEnv())
+	default:
+		return fmt.Errorf("unknown CACHE_BACKEND %q, expected gcs, fs, memory or s3", backend)
+	}
+	if err != nil {
+		cache = nil
+		return err
+	}
+
+	if value := os.Getenv("CACHE_MAX_STALE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid CACHE_MAX_STALE %q", value)
+		}
+		maxStale = parsed
+	}
+
+	if err := loadTTLBounds(); err != nil {
+		return err
+	}
+
+	// Hot repos are served from process memory instead of a round trip to
+	// the object store, CACHE_MEMORY_TIER_MB=0 turns this off
+	if backend != "memory" && os.Getenv("CACHE_MEMORY_TIER_MB") != "0" {
+		tierBytes := envInt("CACHE_MEMORY_TIER_MB", defaultMemoryTierMB) * 1024 * 1024
+		cache = newTieredCache(newMemoryCache(tierBytes), cache)
+		log.Printf("Cache memory tier enabled (%d MB)", tierBytes/1024/1024)
+	}
+
+	log.Printf("Cache initialized with %s backend", backend)
+	return nil
+}
+
+// Close closes the cache backend
+func Close() error {
+	stopSweeper()
+	if cache != nil {
+		return cache.Close()
+	}
+	return nil
+}
+
+// CacheKey generates a cache key for a repository, ref is empty for the
+// default branch
+func CacheKey(username, repo, ref string) string {
+	name := strings.ToLower(username) + "_" + strings.ToLower(repo)
+	if ref != "" {
+		// Refs are case sensitive and may contain slashes
+		name += "@" + url.PathEscape(ref)
+	}
+	return cachePrefix + name + ".json"
+}
+
+// CACHE_EXPIRATION is the TTL of analyses stored without one
+const CACHE_EXPIRATION = 48 * time.Hour
+
+// CachedAnalysis is an encoded analysis. Data holds the JSON compressed
+// with Encoding exactly as it is stored, so cache hits can be sent to the
+// client without decoding or compressing them again.
+type CachedAnalysis struct {
+	Data     []byte
+	Encoding string
+	ETag     string
+	Updated  time.Time
+	Metadata map[string]string
+	// TTL is how long the analysis stays fresh, see CacheTTL
+	TTL time.Duration
+	// Stale is set once the analysis is past its TTL, it is still served but
+	// should be refreshed
+	Stale bool
+	// Contributors is the JSON of the contributor profiles of an analysis
+	// that was just made, cached ones load them with GetContributors
+	Contributors []byte
+}
+
+// HasSection reports whether the cached analysis contains a top level key
+// with a non-null value
+func (c *CachedAnalysis) HasSection(name string) bool {
+	for _, section := range strings.Split(c.Metadata["sections"], ",") {
+		if section == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode returns the analysis as plain JSON, for clients that don't accept
+// the encoding it is stored with
+func (c *CachedAnalysis) Decode() ([]byte, error) {
+	return decompress(c.Data, c.Encoding)
+}
+
+// Result decodes the cached analysis
+func (c *CachedAnalysis) Result() (*api.AnalysisResult, error) {
+	data, err := c.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	var result api.AnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached analysis: %w", err)
+	}
+	return &result, nil
+}
+
+// EncodeAnalysis marshals and compresses an analysis the way it is stored in
+// the cache, so a fresh analysis is sent in the same form as a cache hit
+func EncodeAnalysis(result *api.AnalysisResult) (*CachedAnalysis, error) {
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	encoding := cacheEncoding()
+	compressed, err := compress(jsonData, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	etag := contentHash(jsonData)
+	return &CachedAnalysis{
+		Data:     compressed,
+		Encoding: encoding,
+		ETag:     etag,
+		Updated:  time.Now(),
+		TTL:      CACHE_EXPIRATION,
+		Metadata: map[string]string{
+			"sections":         strings.Join(result.Sections(), ","),
+			"content_encoding": encoding,
+			"etag":             etag,
+			"format_version":   strconv.Itoa(CacheFormatVersion),
+			"analyzer_version": strconv.Itoa(analyzerVersion),
+			"result_version":   strconv.Itoa(result.Version),
+		},
+	}, nil
+}
+
+// GetFromCache retrieves cached analysis data
+func GetFromCache(username, repo, ref string) (*CachedAnalysis, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("storage cache not initialized")
+	}
+
+	start := time.Now()
+	key := CacheKey(username, repo, ref)
+
+	data, info, err := cache.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			log.Printf("[CACHE] Cache miss for %s/%s (took %v)", username, repo, time.Since(start))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cached data: %w", err)
+	}
+
+	// Past the stale limit the analysis is too old to show, even briefly
+	age := time.Since(cachedAt(info))
+	ttl := objectTTL(info)
+	if age > ttl+maxStale {
+		log.Printf("[CACHE] Cache expired for %s/%s, age: %v", username, repo, age)
+		// Delete expired cache in background
+		go func() {
+			if err := cache.Delete(context.Background(), key); err != nil && !errors.Is(err, ErrNotFound) {
+				log.Printf("[CACHE] Failed to delete expired cache: %v", err)
+			}
+		}()
+		return nil, nil
+	}
+
+	switch checkVersion(info.Metadata) {
+	case versionNewer:
+		log.Printf("[CACHE] Cache for %s/%s was written by a newer server, treating as miss", username, repo)
+		return nil, nil
+	case versionObsolete:
+		format, analyzer, result := cacheVersions(info.Metadata)
+		log.Printf("[CACHE] Cache version mismatch for %s/%s (format %d, analyzer %d, result %d), treating as miss",
+			username, repo, format, analyzer, result)
+		return nil, nil
+	case versionUpgradable:
+		analysis, err := upgradeAnalysis(data, info)
+		if err != nil {
+			log.Printf("[CACHE] Failed to upgrade cache for %s/%s, treating as miss: %v", username, repo, err)
+			return nil, nil
+		}
+
+		go func() {
+			if err := cache.Put(context.Background(), key, analysis.Data, analysis.Metadata); err != nil {
+				log.Printf("[CACHE] Failed to store upgraded cache for %s/%s: %v", username, repo, err)
+			}
+		}()
+
+		log.Printf("[CACHE] Cache hit for %s/%s! Upgraded to the current format (took %v, cached %v ago)",
+			username, repo, time.Since(start), age)
+		analysis.Stale = age > ttl
+		return analysis, nil
+	}
+
+	stale := age > ttl
+	if stale {
+		log.Printf("[CACHE] Stale cache hit for %s/%s (took %v, cached %v ago)",
+			username, repo, time.Since(start), age)
+	} else {
+		log.Printf("[CACHE] Cache hit for %s/%s! (took %v, cached %v ago)",
+			username, repo, time.Since(start), age)
+	}
+
+	return &CachedAnalysis{
+		Data:     data,
+		Encoding: info.Metadata["content_encoding"],
+		ETag:     info.Metadata["etag"],
+		Updated:  cachedAt(info),
+		Metadata: info.Metadata,
+		TTL:      ttl,
+		Stale:    stale,
+	}, nil
+}
+
+// StoreInCache stores an analysis encoded by EncodeAnalysis in the cache
+func StoreInCache(username, repo, ref string, analysis *CachedAnalysis) error {
+	if cache == nil {
+		return fmt.Errorf("storage cache not initialized")
+	}
+
+	start := time.Now()
+	key := CacheKey(username, repo, ref)
+
+	// During a rolling deploy the older servers answer from their own
+	// analysis but keep the newer object
+	if info, err := cache.Stat(ctx, key); err == nil && checkVersion(info.Metadata) == versionNewer {
+		log.Printf("[CACHE] Not replacing the newer cache of %s/%s", username, repo)
+		return nil
+	}
+
+	metadata := map[string]string{
+		"username":  username,
+		"repo":      repo,
+		"cached_at": time.Now().Format(time.RFC3339),
+	}
+	if ref != "" {
+		metadata["ref"] = ref
+	}
+	for k, v := range analysis.Metadata {
+		metadata[k] = v
+	}
+	metadata["ttl"] = strconv.Itoa(int(analysis.TTL.Seconds()))
+
+	if err := cache.Put(ctx, key, analysis.Data, metadata); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	log.Printf("[CACHE] Successfully cached %s/%s (took %v, size: %.2f KB)",
+		username, repo, time.Since(start), float64(len(analysis.Data))/1024)
+
+	return nil
+}
+
+// ClearCache removes cached data for a specific repository
+func ClearCache(username, repo string) error {
+	if cache == nil {
+		return fmt.Errorf("storage cache not initialized")
+	}
+
+	if err := cache.Delete(ctx, CacheKey(username, repo, "")); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			log.Printf("[CACHE] No cache to clear for %s/%s", username, repo)
+			return nil
+		}
+		return fmt.Errorf("failed to delete cache: %w", err)
+	}
+
+	log.Printf("[CACHE] Cleared cache for %s/%s", username, repo)
+	return nil
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contributor profiles are cached in their own object next to the analysis
+// they were built with, most clients never ask for them
+
+func contributorsKey(username, repo, ref string) string {
+	return strings.TrimSuffix(CacheKey(username, repo, ref), ".json") + ".contributors.json"
+}
+
+// StoreContributors caches the JSON contributor profiles of an analysis
+// stored by StoreInCache. They expire with the analysis.
+func StoreContributors(username, repo, ref string, analysis *CachedAnalysis, profiles []byte) error {
+	if cache == nil {
+		return fmt.Errorf("storage cache not initialized")
+	}
+
+	encoding := cacheEncoding()
+	data, err := compress(profiles, encoding)
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]string{
+		"username":         username,
+		"repo":             repo,
+		"cached_at":        time.Now().Format(time.RFC3339),
+		"ttl":              strconv.Itoa(int(analysis.TTL.Seconds())),
+		"content_encoding": encoding,
+		"analysis_etag":    analysis.ETag,
+		"format_version":   analysis.Metadata["format_version"],
+		"analyzer_version": analysis.Metadata["analyzer_version"],
+		"result_version":   analysis.Metadata["result_version"],
+	}
+	if ref != "" {
+		metadata["ref"] = ref
+	}
+
+	if err := cache.Put(ctx, contributorsKey(username, repo, ref), data, metadata); err != nil {
+		return fmt.Errorf("failed to write contributors: %w", err)
+	}
+	return nil
+}
+
+// GetContributors returns the JSON contributor profiles cached with an
+// analysis, nil when there are none or they belong to another analysis
+func GetContributors(username, repo, ref string, analysis *CachedAnalysis) ([]byte, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("storage cache not initialized")
+	}
+
+	data, info, err := cache.Get(ctx, contributorsKey(username, repo, ref))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read contributors: %w", err)
+	}
+
+	if info.Metadata["analysis_etag"] != analysis.ETag {
+		log.Printf("[CACHE] Cached contributors of %s/%s belong to another analysis", username, repo)
+		return nil, nil
+	}
+	return decompress(data, info.Metadata["content_encoding"])
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings cache objects can be stored with, they match the HTTP
+// Content-Encoding tokens so objects can be sent to clients as they are
+const (
+	EncodingIdentity = ""
+	EncodingGzip     = "gzip"
+	EncodingBrotli   = "br"
+)
+
+// cacheEncoding picks the encoding new cache objects are stored with from
+// CACHE_ENCODING, gzip unless set to br
+func cacheEncoding() string {
+	if os.Getenv("CACHE_ENCODING") == EncodingBrotli {
+		return EncodingBrotli
+	}
+	return EncodingGzip
+}
+
+// contentHash identifies encoded analysis bytes, it is used as the ETag
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// compress encodes data once when it is stored, so it pays for a better
+// compression level than compressing every response would
+func compress(data []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+
+	switch encoding {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		writer, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	case EncodingBrotli:
+		writer = brotli.NewWriterLevel(&buf, brotli.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("unsupported cache encoding %q", encoding)
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte, encoding string) ([]byte, error) {
+	var reader io.Reader
+
+	switch encoding {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress data: %w", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case EncodingBrotli:
+		reader = brotli.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported cache encoding %q", encoding)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress data: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metadataSuffix marks the sidecar file holding an object's metadata
+const metadataSuffix = ".meta"
+
+// filesystemCache stores cache objects as files below a root directory
+type filesystemCache struct {
+	root string
+}
+
+func newFilesystemCache(root string) (*filesystemCache, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &filesystemCache{root: root}, nil
+}
+
+func (f *filesystemCache) Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fsError(err)
+	}
+
+	info, err := f.stat(key, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, info, nil
+}
+
+func (f *filesystemCache) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	// The sidecar goes last, until it is written the object reads as an
+	// unversioned one and is a miss rather than new data with old metadata
+	if err := os.Remove(path + metadataSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove metadata: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(path+metadataSuffix, metadataJSON)
+}
+
+func (f *filesystemCache) Delete(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fsError(err)
+	}
+	os.Remove(path + metadataSuffix)
+
+	return nil
+}
+
+func (f *filesystemCache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return f.stat(key, path)
+}
+
+func (f *filesystemCache) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	err := filepath.WalkDir(f.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, metadataSuffix) || strings.Contains(entry.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := f.stat(key, path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache directory: %w", err)
+	}
+
+	return objects, nil
+}
+
+func (f *filesystemCache) Close() error {
+	return nil
+}
+
+// path maps a key to its file, keys must stay inside the cache directory
+func (f *filesystemCache) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(f.root, cleaned), nil
+}
+
+func (f *filesystemCache) stat(key, path string) (*ObjectInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fsError(err)
+	}
+
+	info := &ObjectInfo{
+		Key:      key,
+		Size:     stat.Size(),
+		Updated:  stat.ModTime(),
+		Metadata: map[string]string{},
+	}
+
+	if metadataJSON, err := os.ReadFile(path + metadataSuffix); err == nil {
+		if err := json.Unmarshal(metadataJSON, &info.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata of %s: %w", key, err)
+		}
+	}
+
+	return info, nil
+}
+
+// writeFileAtomic writes through a temporary file so readers never see a
+// partially written object
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
+
+func fsError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
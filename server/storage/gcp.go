@@ -2,187 +2,123 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"strings"
-	"time"
 
 	"cloud.google.com/go/storage"
-	database "github.com/immatheus/gitback/databases"
+	"google.golang.org/api/iterator"
 )
 
-var (
-	client     *storage.Client
-	bucketName string
-	ctx        context.Context
-)
+// gcsCache stores cache objects in a Google Cloud Storage bucket
+type gcsCache struct {
+	client *storage.Client
+	bucket string
+}
 
-// Init initializes the GCP storage client
-func Init() error {
-	bucketName = os.Getenv("GCP_BUCKET_NAME")
+func newGCSCache(bucketName string) (*gcsCache, error) {
 	if bucketName == "" {
-		return fmt.Errorf("GCP_BUCKET_NAME environment variable not set")
+		return nil, fmt.Errorf("GCP_BUCKET_NAME environment variable not set")
 	}
 
-	ctx = context.Background()
-
 	// This automatically handles authentication:
 	// - Locally: reads GOOGLE_APPLICATION_CREDENTIALS env var
 	// - Cloud Run: uses attached service account automatically
-	var err error
-	client, err = storage.NewClient(ctx)
+	client, err := storage.NewClient(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create storage client: %w", err)
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
 	}
 
 	log.Printf("GCP Storage initialized with bucket: %s", bucketName)
-	return nil
+	return &gcsCache{client: client, bucket: bucketName}, nil
 }
 
-// Close closes the storage client
-func Close() error {
-	if client != nil {
-		return client.Close()
-	}
-	return nil
-}
-
-// CacheKey generates a cache key for a repository
-func CacheKey(username, repo string) string {
-	return fmt.Sprintf("cache/%s_%s.json", strings.ToLower(username), strings.ToLower(repo))
-}
-
-const CACHE_EXPIRATION = 48 * time.Hour
-
-// GetFromCache retrieves cached analysis data from GCP Storage
-func GetFromCache(username, repo string) (map[string]interface{}, error) {
-	if client == nil {
-		return nil, fmt.Errorf("storage client not initialized")
-	}
-
-	start := time.Now()
-	key := CacheKey(username, repo)
-
-	bucket := client.Bucket(bucketName)
-	obj := bucket.Object(key)
+func (g *gcsCache) Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error) {
+	obj := g.client.Bucket(g.bucket).Object(key)
 
-	// Check if object exists and get metadata
 	attrs, err := obj.Attrs(ctx)
 	if err != nil {
-		if err == storage.ErrObjectNotExist {
-			log.Printf("[CACHE] Cache miss for %s/%s (took %v)", username, repo, time.Since(start))
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get object attributes: %w", err)
-	}
-
-	// Check if cache is expired (older than 48 hours)
-	if time.Since(attrs.Updated) > CACHE_EXPIRATION {
-		log.Printf("[CACHE] Cache expired for %s/%s, age: %v", username, repo, time.Since(attrs.Updated))
-		// Delete expired cache in background
-		go func() {
-			if err := obj.Delete(context.Background()); err != nil {
-				log.Printf("[CACHE] Failed to delete expired cache: %v", err)
-			}
-		}()
-		return nil, nil
+		return nil, nil, gcsError(err)
 	}
 
-	// Read the cached data
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create reader: %w", err)
+		return nil, nil, gcsError(err)
 	}
 	defer reader.Close()
 
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read cached data: %w", err)
+		return nil, nil, fmt.Errorf("failed to read object: %w", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cached data: %w", err)
-	}
-
-	log.Printf("[CACHE] Cache hit for %s/%s! (took %v, cached %v ago)",
-		username, repo, time.Since(start), time.Since(attrs.Updated))
-
-	return result, nil
+	return data, gcsObjectInfo(attrs), nil
 }
 
-// StoreInCache stores analysis data in GCP Storage cache
-func StoreInCache(username, repo string, data map[string]interface{}) error {
-	if client == nil {
-		return fmt.Errorf("storage client not initialized")
-	}
-
-	start := time.Now()
-	key := CacheKey(username, repo)
-
-	// Marshal data to JSON
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
-	}
-
-	bucket := client.Bucket(bucketName)
-	obj := bucket.Object(key)
-	writer := obj.NewWriter(ctx)
-
-	// Set metadata
+func (g *gcsCache) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	writer := g.client.Bucket(g.bucket).Object(key).NewWriter(ctx)
 	writer.ContentType = "application/json"
-	writer.Metadata = map[string]string{
-		"username":  username,
-		"repo":      repo,
-		"cached_at": time.Now().Format(time.RFC3339),
-	}
+	writer.Metadata = metadata
 
-	// Write data
-	if _, err := writer.Write(jsonData); err != nil {
+	if _, err := writer.Write(data); err != nil {
 		writer.Close()
-		return fmt.Errorf("failed to write data: %w", err)
+		return fmt.Errorf("failed to write object: %w", err)
 	}
 
 	if err := writer.Close(); err != nil {
 		return fmt.Errorf("failed to close writer: %w", err)
 	}
 
-	log.Printf("[CACHE] Successfully cached %s/%s (took %v, size: %.2f KB)",
-		username, repo, time.Since(start), float64(len(jsonData))/1024)
+	return nil
+}
 
-	// Update last cached timestamp in database
-	go func() {
-		if err := database.UpdateLastCachedAt(username, repo); err != nil {
-			log.Printf("[CACHE] Failed to update last cached timestamp for %s/%s: %v", username, repo, err)
-		}
-	}()
+func (g *gcsCache) Delete(ctx context.Context, key string) error {
+	return gcsError(g.client.Bucket(g.bucket).Object(key).Delete(ctx))
+}
 
-	return nil
+func (g *gcsCache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	attrs, err := g.client.Bucket(g.bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+	return gcsObjectInfo(attrs), nil
 }
 
-// ClearCache removes cached data for a specific repository
-func ClearCache(username, repo string) error {
-	if client == nil {
-		return fmt.Errorf("storage client not initialized")
+func (g *gcsCache) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		objects = append(objects, *gcsObjectInfo(attrs))
 	}
 
-	key := CacheKey(username, repo)
+	return objects, nil
+}
 
-	bucket := client.Bucket(bucketName)
-	obj := bucket.Object(key)
+func (g *gcsCache) Close() error {
+	return g.client.Close()
+}
 
-	if err := obj.Delete(ctx); err != nil {
-		if err == storage.ErrObjectNotExist {
-			log.Printf("[CACHE] No cache to clear for %s/%s", username, repo)
-			return nil
-		}
-		return fmt.Errorf("failed to delete cache: %w", err)
+func gcsObjectInfo(attrs *storage.ObjectAttrs) *ObjectInfo {
+	return &ObjectInfo{
+		Key:      attrs.Name,
+		Size:     attrs.Size,
+		Updated:  attrs.Updated,
+		Metadata: attrs.Metadata,
 	}
+}
 
-	log.Printf("[CACHE] Cleared cache for %s/%s", username, repo)
-	return nil
+func gcsError(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrNotFound
+	}
+	return err
 }
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryCache keeps cache objects in process, evicting the least recently
+// used ones once the total size goes over maxBytes
+type memoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List // front is the most recently used
+}
+
+type memoryEntry struct {
+	data []byte
+	info ObjectInfo
+}
+
+func newMemoryCache(maxBytes int) *memoryCache {
+	return &memoryCache{
+		maxBytes: int64(maxBytes),
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	m.order.MoveToFront(element)
+
+	entry := element.Value.(*memoryEntry)
+	info := entry.info
+	return entry.data, &info, nil
+}
+
+func (m *memoryCache) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	return m.put(data, ObjectInfo{Key: key, Size: int64(len(data)), Updated: time.Now(), Metadata: metadata})
+}
+
+// put stores an object under info.Key keeping the given info, the tiered
+// cache uses it to carry over the Updated time of the object store
+func (m *memoryCache) put(data []byte, info ObjectInfo) error {
+	size := int64(len(data))
+	if size > m.maxBytes {
+		return fmt.Errorf("object of %d bytes does not fit in a %d byte memory cache", size, m.maxBytes)
+	}
+
+	copied := make(map[string]string, len(info.Metadata))
+	for k, v := range info.Metadata {
+		copied[k] = v
+	}
+	info.Size = size
+	info.Metadata = copied
+	entry := &memoryEntry{data: data, info: info}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[info.Key]; ok {
+		m.remove(element)
+	}
+	m.items[info.Key] = m.order.PushFront(entry)
+	m.size += size
+
+	for m.size > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+
+	return nil
+}
+
+func (m *memoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return ErrNotFound
+	}
+	m.remove(element)
+	return nil
+}
+
+func (m *memoryCache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	info := element.Value.(*memoryEntry).info
+	return &info, nil
+}
+
+func (m *memoryCache) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var objects []ObjectInfo
+	for key, element := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, element.Value.(*memoryEntry).info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+func (m *memoryCache) Close() error {
+	return nil
+}
+
+// remove drops an element, the caller must hold the lock
+func (m *memoryCache) remove(element *list.Element) {
+	entry := m.order.Remove(element).(*memoryEntry)
+	delete(m.items, entry.info.Key)
+	m.size -= entry.info.Size
+}
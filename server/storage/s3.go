@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config holds the connection settings of an S3 compatible bucket
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+func s3ConfigFromEnv() S3Config {
+	return S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		Region:          os.Getenv("S3_REGION"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		// Local MinIO usually runs without TLS
+		UseSSL: os.Getenv("S3_USE_SSL") != "false",
+	}
+}
+
+// s3Cache stores cache objects in an S3 compatible bucket, AWS S3 as well as
+// MinIO or any other server speaking the S3 API
+type s3Cache struct {
+	client *minio.Client
+	bucket string
+}
+
+func newS3Cache(config S3Config) (*s3Cache, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET environment variables must be set")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(context.Background(), config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", config.Bucket)
+	}
+
+	log.Printf("S3 storage initialized with bucket: %s at %s", config.Bucket, config.Endpoint)
+	return &s3Cache{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *s3Cache) Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	defer obj.Close()
+
+	// GetObject is lazy, Stat is the first call that reaches the server
+	stat, err := obj.Stat()
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	return data, s3ObjectInfo(stat), nil
+}
+
+func (s *s3Cache) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  "application/json",
+		UserMetadata: metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3Cache) Delete(ctx context.Context, key string) error {
+	// S3 deletes are idempotent, stat first so missing keys behave like the
+	// other backends
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Cache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return s3ObjectInfo(stat), nil
+}
+
+func (s *s3Cache) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// Returning early leaves the listing goroutine blocked on its channel
+	// until ctx is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, *s3ObjectInfo(object))
+	}
+
+	return objects, nil
+}
+
+func (s *s3Cache) Close() error {
+	return nil
+}
+
+func s3ObjectInfo(object minio.ObjectInfo) *ObjectInfo {
+	// S3 returns metadata keys in canonical header form, e.g. Cached_at
+	metadata := make(map[string]string, len(object.UserMetadata))
+	for k, v := range object.UserMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+
+	return &ObjectInfo{
+		Key:      object.Key,
+		Size:     object.Size,
+		Updated:  object.LastModified,
+		Metadata: metadata,
+	}
+}
+
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+const defaultMemoryTierMB = 128
+
+// tieredCache keeps recently used objects in process in front of a slower
+// object store. Memory entries keep the object's metadata and expire with
+// its own TTL, so both tiers agree on freshness.
+type tieredCache struct {
+	memory *memoryCache
+	object Cache
+}
+
+func newTieredCache(memory *memoryCache, object Cache) *tieredCache {
+	return &tieredCache{memory: memory, object: object}
+}
+
+func (t *tieredCache) Get(ctx context.Context, key string) ([]byte, *ObjectInfo, error) {
+	if data, info, err := t.memory.Get(ctx, key); err == nil {
+		if withinStaleLimit(info) {
+			return data, info, nil
+		}
+		t.memory.Delete(ctx, key)
+	}
+
+	data, info, err := t.object.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Objects too large for the memory tier are simply served from below
+	t.memory.put(data, *info)
+	return data, info, nil
+}
+
+func (t *tieredCache) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	if err := t.object.Put(ctx, key, data, metadata); err != nil {
+		t.memory.Delete(ctx, key)
+		return err
+	}
+
+	t.memory.Put(ctx, key, data, metadata)
+	return nil
+}
+
+func (t *tieredCache) Delete(ctx context.Context, key string) error {
+	memoryErr := t.memory.Delete(ctx, key)
+	objectErr := t.object.Delete(ctx, key)
+
+	// Only report a miss when neither tier had the key
+	if errors.Is(objectErr, ErrNotFound) && memoryErr == nil {
+		return nil
+	}
+	return objectErr
+}
+
+func (t *tieredCache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	if info, err := t.memory.Stat(ctx, key); err == nil && withinStaleLimit(info) {
+		return info, nil
+	}
+	return t.object.Stat(ctx, key)
+}
+
+func (t *tieredCache) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return t.object.List(ctx, prefix)
+}
+
+func (t *tieredCache) Close() error {
+	return t.object.Close()
+}
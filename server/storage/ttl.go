@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMinTTL = 6 * time.Hour
+	defaultMaxTTL = 30 * 24 * time.Hour
+
+	// An analysis is refreshed after roughly this many new commits
+	commitsPerRefresh = 25
+	// Repos without a commit or push for this long count as dormant
+	dormantAfter = 365 * 24 * time.Hour
+)
+
+// Operator bounds on every cache TTL, CACHE_TTL_MIN and CACHE_TTL_MAX
+var (
+	minTTL = defaultMinTTL
+	maxTTL = defaultMaxTTL
+)
+
+// RepoActivity is what the cache TTL of a repo is picked from
+type RepoActivity struct {
+	LastCommit time.Time
+	// LastPush comes from the forge, zero when it is unknown
+	LastPush time.Time
+	// RecentCommits counts the commits of the last 30 days
+	RecentCommits int
+	Archived      bool
+}
+
+// CacheTTL picks how long an analysis stays fresh. Archived and dormant
+// repos keep theirs for the longest allowed time, otherwise it grows with
+// the time since the last activity and shrinks with the commit rate.
+func CacheTTL(activity RepoActivity) time.Duration {
+	lastActivity := activity.LastCommit
+	if activity.LastPush.After(lastActivity) {
+		lastActivity = activity.LastPush
+	}
+	if lastActivity.IsZero() {
+		return clampTTL(CACHE_EXPIRATION)
+	}
+
+	idle := time.Since(lastActivity)
+	if activity.Archived || idle > dormantAfter {
+		return maxTTL
+	}
+
+	ttl := idle / 4
+	if activity.RecentCommits > 0 {
+		perCommit := 30 * 24 * time.Hour / time.Duration(activity.RecentCommits)
+		if byRate := perCommit * commitsPerRefresh; byRate < ttl {
+			ttl = byRate
+		}
+	}
+
+	return clampTTL(ttl.Round(time.Minute))
+}
+
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl < minTTL {
+		return minTTL
+	}
+	if ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
+
+// objectTTL is the TTL an object was stored with, objects from before TTLs
+// were stored use CACHE_EXPIRATION. Bounds apply on read too so changing
+// them takes effect without waiting for every repo to be re-analyzed.
+func objectTTL(info *ObjectInfo) time.Duration {
+	ttl := CACHE_EXPIRATION
+	if seconds, err := strconv.Atoi(info.Metadata["ttl"]); err == nil && seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	return clampTTL(ttl)
+}
+
+// loadTTLBounds reads CACHE_TTL_MIN and CACHE_TTL_MAX
+func loadTTLBounds() error {
+	for _, bound := range []struct {
+		name  string
+		value *time.Duration
+	}{{"CACHE_TTL_MIN", &minTTL}, {"CACHE_TTL_MAX", &maxTTL}} {
+		value := os.Getenv(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid %s %q", bound.name, value)
+		}
+		*bound.value = parsed
+	}
+
+	if minTTL > maxTTL {
+		return fmt.Errorf("CACHE_TTL_MIN %v is larger than CACHE_TTL_MAX %v", minTTL, maxTTL)
+	}
+	return nil
+}
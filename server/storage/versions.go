@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/immatheus/gitback/api"
+)
+
+// CacheFormatVersion describes how cached analyses are encoded. Format 1
+// was plain JSON without metadata, format 2 is compressed and carries a
+// content hash. Changes to the JSON itself bump api.Version instead.
+const CacheFormatVersion = 2
+
+const (
+	cachePrefix          = "cache/"
+	defaultSweepInterval = 6 * time.Hour
+)
+
+type versionStatus int
+
+const (
+	versionCurrent versionStatus = iota
+	versionUpgradable
+	versionObsolete
+	// Written by a newer server during a rolling deploy, read as a miss
+	// and never overwritten
+	versionNewer
+)
+
+var sweeperStop chan struct{}
+
+// cacheVersions reads the versions an object was stored with. Objects from
+// before versioning carry none and come from analyzer 1, results from before
+// api.AnalysisResult was versioned are result version 0.
+func cacheVersions(metadata map[string]string) (format, analyzer, result int) {
+	format, analyzer = 1, 1
+	// Compressed objects were written before the version was recorded
+	if metadata["content_encoding"] != "" {
+		format = 2
+	}
+	if v, err := strconv.Atoi(metadata["format_version"]); err == nil {
+		format = v
+	}
+	if v, err := strconv.Atoi(metadata["analyzer_version"]); err == nil {
+		analyzer = v
+	}
+	if v, err := strconv.Atoi(metadata["result_version"]); err == nil {
+		result = v
+	}
+	return format, analyzer, result
+}
+
+func checkVersion(metadata map[string]string) versionStatus {
+	format, analyzer, result := cacheVersions(metadata)
+	switch {
+	case format > CacheFormatVersion || analyzer > analyzerVersion || result > api.Version:
+		return versionNewer
+	case analyzer < analyzerVersion:
+		return versionObsolete
+	case format == CacheFormatVersion && result == api.Version:
+		return versionCurrent
+	// Unversioned results have the same shape as version 1
+	case (format == 1 || format == CacheFormatVersion) && (result == 0 || result == api.Version):
+		return versionUpgradable
+	}
+	return versionObsolete
+}
+
+// cachedAt is when the analysis was made. Upgrading an object rewrites it,
+// so the object's own timestamp can be newer than the analysis.
+func cachedAt(info *ObjectInfo) time.Time {
+	if t, err := time.Parse(time.RFC3339, info.Metadata["cached_at"]); err == nil {
+		return t
+	}
+	return info.Updated
+}
+
+// withinStaleLimit tells whether an object is still young enough to serve,
+// its own TTL plus maxStale
+func withinStaleLimit(info *ObjectInfo) bool {
+	return time.Since(cachedAt(info)) <= objectTTL(info)+maxStale
+}
+
+// upgradeAnalysis re-encodes an object stored as plain JSON or without a
+// result version in the current format. The analysis itself is unchanged so
+// it keeps its metadata.
+func upgradeAnalysis(data []byte, info *ObjectInfo) (*CachedAnalysis, error) {
+	jsonData, err := decompress(data, info.Metadata["content_encoding"])
+	if err != nil {
+		return nil, err
+	}
+
+	var result api.AnalysisResult
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode cached analysis: %w", err)
+	}
+	result.Version = api.Version
+
+	analysis, err := EncodeAnalysis(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range info.Metadata {
+		if _, ok := analysis.Metadata[k]; !ok {
+			analysis.Metadata[k] = v
+		}
+	}
+	analysis.Updated = cachedAt(info)
+	analysis.TTL = objectTTL(info)
+	return analysis, nil
+}
+
+// StartSweeper deletes expired and obsolete cache objects every
+// CACHE_SWEEP_INTERVAL (default 6h), CACHE_SWEEP_INTERVAL=0 turns it off
+func StartSweeper() {
+	if cache == nil || sweeperStop != nil {
+		return
+	}
+
+	interval := defaultSweepInterval
+	if value := os.Getenv("CACHE_SWEEP_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("[CACHE] Invalid CACHE_SWEEP_INTERVAL %q, using %v", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		log.Printf("[CACHE] Cache sweeper disabled")
+		return
+	}
+
+	stop := make(chan struct{})
+	sweeperStop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := SweepCache(); err != nil {
+					log.Printf("[CACHE] Sweep failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("[CACHE] Cache sweeper started, running every %v", interval)
+}
+
+func stopSweeper() {
+	if sweeperStop != nil {
+		close(sweeperStop)
+		sweeperStop = nil
+	}
+}
+
+// SweepCache deletes cached analyses past the stale limit or written by
+// an older analyzer or in a format that can't be upgraded on read. It
+// returns how many objects were deleted.
+func SweepCache() (int, error) {
+	if cache == nil {
+		return 0, fmt.Errorf("storage cache not initialized")
+	}
+
+	start := time.Now()
+	objects, err := cache.List(ctx, cachePrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, object := range objects {
+		// Not every backend lists user metadata, S3 for one
+		info := &object
+		if info.Metadata["format_version"] == "" {
+			if info, err = cache.Stat(ctx, object.Key); err != nil {
+				continue
+			}
+		}
+
+		if withinStaleLimit(info) && checkVersion(info.Metadata) != versionObsolete {
+			continue
+		}
+
+		if err := cache.Delete(ctx, object.Key); err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("[CACHE] Failed to delete %s: %v", object.Key, err)
+			continue
+		}
+		deleted++
+	}
+
+	log.Printf("[CACHE] Sweep deleted %d of %d cached analyses (took %v)", deleted, len(objects), time.Since(start))
+	return deleted, nil
+}